@@ -0,0 +1,125 @@
+package gospeech
+
+import (
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+const (
+	PrimaryStressMark   = "ˈ"
+	SecondaryStressMark = "ˌ"
+)
+
+// ARPAbetTable maps ARPAbet phonemes (without stress digits) to the IPA symbols understood by
+// DefaultVoice.
+var ARPAbetTable = map[string]string{
+	"AA": "a",
+	"AE": "æ",
+	"AH": "ʌ",
+	"AO": "ɔ",
+	"AW": "aʊ",
+	"AY": "aI",
+	"EH": "ɛ",
+	"ER": "əɹ",
+	"EY": "eI",
+	"IH": "I",
+	"IY": "i",
+	"OW": "oʊ",
+	"OY": "ɔI",
+	"UH": "ʊ",
+	"UW": "u",
+	"B":  "b",
+	"CH": "tʃ",
+	"D":  "d",
+	"DH": "ð",
+	"F":  "f",
+	"G":  "g",
+	"HH": "h",
+	"JH": "dʒ",
+	"K":  "k",
+	"L":  "l",
+	"M":  "m",
+	"N":  "n",
+	"NG": "ŋ",
+	"P":  "p",
+	"R":  "ɹ",
+	"S":  "s",
+	"SH": "ʃ",
+	"T":  "t",
+	"TH": "θ",
+	"V":  "v",
+	"W":  "w",
+	"Y":  "j",
+	"Z":  "z",
+	"ZH": "ʒ",
+}
+
+// ARPAbetToIPA converts a sequence of ARPAbet phonemes, such as "HH AH0 L OW1", to IPA.
+//
+// Stress digits are preserved as IPA stress marks placed before the stressed vowel.
+// A 1 becomes PrimaryStressMark, a 2 becomes SecondaryStressMark, and a 0 is dropped.
+func ARPAbetToIPA(phonemes string) (string, error) {
+	var res []string
+	for _, ph := range strings.Fields(phonemes) {
+		ph = strings.ToUpper(ph)
+		var stress string
+		if last := ph[len(ph)-1]; last >= '0' && last <= '2' {
+			switch last {
+			case '1':
+				stress = PrimaryStressMark
+			case '2':
+				stress = SecondaryStressMark
+			}
+			ph = ph[:len(ph)-1]
+		}
+		ipa, ok := ARPAbetTable[ph]
+		if !ok {
+			return "", errors.New("unknown ARPAbet phoneme: " + ph)
+		}
+		res = append(res, stress+ipa)
+	}
+	return strings.Join(res, ""), nil
+}
+
+// LoadARPAbetDictionary reads a dictionary in the format of the raw CMU Pronouncing Dictionary.
+//
+// Every line contains a word followed by its ARPAbet phonemes, separated by whitespace.
+// Alternative pronunciations are listed with a numeric suffix, as in "READ(2)".
+// Lines starting with ";;;" and anything after a "#" are treated as comments.
+func LoadARPAbetDictionary(path string) (Dictionary, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(contents), "\n")
+	res := Dictionary{}
+	seen := map[string]bool{}
+	for i, line := range lines {
+		if strings.HasPrefix(line, ";;;") {
+			continue
+		}
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		} else if len(fields) == 1 {
+			return nil, errors.New("missing phonemes at line: " + strconv.Itoa(i))
+		}
+		entry := strings.ToLower(fields[0])
+		if seen[entry] {
+			return nil, errors.New("repeated entry: " + entry)
+		}
+		seen[entry] = true
+		ipa, err := ARPAbetToIPA(strings.Join(fields[1:], " "))
+		if err != nil {
+			return nil, errors.New(err.Error() + " at line: " + strconv.Itoa(i))
+		}
+		word := stripVariantSuffix(entry)
+		res[word] = append(res[word], Pronunciation{IPA: ipa})
+	}
+	return res, nil
+}
@@ -0,0 +1,193 @@
+package gospeech
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// An asciiAlphabet maps the symbols of an ASCII phonetic alphabet to IPA symbols understood by
+// DefaultVoice.
+// Symbols which have no audible effect map to the empty string.
+type asciiAlphabet map[string]string
+
+// toIPA converts a string by repeatedly replacing the longest symbol at the start of the input.
+// Whitespace is collapsed into single spaces, which separate words.
+func (a asciiAlphabet) toIPA(name, s string) (string, error) {
+	var maxLen int
+	for sym := range a {
+		if len(sym) > maxLen {
+			maxLen = len(sym)
+		}
+	}
+
+	words := strings.Fields(s)
+	res := make([]string, 0, len(words))
+	for _, word := range words {
+		var converted string
+		for len(word) > 0 {
+			match := false
+			for l := maxLen; l > 0; l-- {
+				if l > len(word) {
+					continue
+				}
+				if ipa, ok := a[word[:l]]; ok {
+					converted += ipa
+					word = word[l:]
+					match = true
+					break
+				}
+			}
+			if !match {
+				r, _ := utf8.DecodeRuneInString(word)
+				return "", errors.New("unknown " + name + " symbol: " + string(r))
+			}
+		}
+		if converted != "" {
+			res = append(res, converted)
+		}
+	}
+	return strings.Join(res, " "), nil
+}
+
+// xsampaAlphabet covers the X-SAMPA symbols needed for English, plus close stand-ins for common
+// symbols from other languages.
+var xsampaAlphabet = asciiAlphabet{
+	"i":   "i",
+	"I":   "I",
+	"e":   "e",
+	"E":   "ɛ",
+	"{":   "æ",
+	"a":   "a",
+	"A":   "a",
+	"Q":   "ɔ",
+	"O":   "ɔ",
+	"o":   "o",
+	"U":   "ʊ",
+	"u":   "u",
+	"V":   "ʌ",
+	"@":   "ə",
+	"@`":  "əɹ",
+	"3":   "ə",
+	"3`":  "əɹ",
+	"6":   "ə",
+	"1":   "I",
+	"}":   "u",
+	"y":   "i",
+	"Y":   "I",
+	"2":   "e",
+	"9":   "ɛ",
+	"p":   "p",
+	"b":   "b",
+	"t":   "t",
+	"d":   "d",
+	"k":   "k",
+	"g":   "g",
+	"m":   "m",
+	"n":   "n",
+	"N":   "ŋ",
+	"f":   "f",
+	"v":   "v",
+	"T":   "θ",
+	"D":   "ð",
+	"s":   "s",
+	"z":   "z",
+	"S":   "ʃ",
+	"Z":   "ʒ",
+	"x":   "h",
+	"h":   "h",
+	"h\\": "h",
+	"tS":  "tʃ",
+	"dZ":  "dʒ",
+	"l":   "l",
+	"5":   "l",
+	"r":   "ɹ",
+	"r\\": "ɹ",
+	"R":   "ɹ",
+	"4":   "ɾ",
+	"j":   "j",
+	"w":   "w",
+	"W":   "w",
+	"?":   "ʔ",
+	"\"":  PrimaryStressMark,
+	"%":   SecondaryStressMark,
+	":":   "",
+	".":   "",
+	"=":   "",
+	"~":   "",
+	"`":   "",
+	"_h":  "",
+	"_0":  "",
+	"/":   "",
+	"[":   "",
+	"]":   "",
+}
+
+// kirshenbaumAlphabet covers the Kirshenbaum (ASCII-IPA) symbols needed for English, plus close
+// stand-ins for common symbols from other languages.
+var kirshenbaumAlphabet = asciiAlphabet{
+	"i":   "i",
+	"I":   "I",
+	"e":   "e",
+	"E":   "ɛ",
+	"&":   "æ",
+	"a":   "a",
+	"A":   "a",
+	"O":   "ɔ",
+	"o":   "o",
+	"U":   "ʊ",
+	"u":   "u",
+	"V":   "ʌ",
+	"@":   "ə",
+	"3":   "ə",
+	"R":   "əɹ",
+	"y":   "i",
+	"Y":   "I",
+	"p":   "p",
+	"b":   "b",
+	"t":   "t",
+	"d":   "d",
+	"k":   "k",
+	"g":   "g",
+	"m":   "m",
+	"n":   "n",
+	"N":   "ŋ",
+	"f":   "f",
+	"v":   "v",
+	"T":   "θ",
+	"D":   "ð",
+	"s":   "s",
+	"z":   "z",
+	"S":   "ʃ",
+	"Z":   "ʒ",
+	"x":   "h",
+	"h":   "h",
+	"tS":  "tʃ",
+	"dZ":  "dʒ",
+	"l":   "l",
+	"L":   "l",
+	"r":   "ɹ",
+	"*":   "ɾ",
+	"j":   "j",
+	"w":   "w",
+	"?":   "ʔ",
+	"'":   PrimaryStressMark,
+	",":   SecondaryStressMark,
+	":":   "",
+	"-":   "",
+	"~":   "",
+	"<h>": "",
+	"/":   "",
+	"[":   "",
+	"]":   "",
+}
+
+// XSAMPAToIPA converts an X-SAMPA transcription, such as "h@\"l@U", to IPA.
+func XSAMPAToIPA(xsampa string) (string, error) {
+	return xsampaAlphabet.toIPA("X-SAMPA", xsampa)
+}
+
+// KirshenbaumToIPA converts a Kirshenbaum transcription, such as "h@'loU", to IPA.
+func KirshenbaumToIPA(kirshenbaum string) (string, error) {
+	return kirshenbaumAlphabet.toIPA("Kirshenbaum", kirshenbaum)
+}
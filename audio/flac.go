@@ -0,0 +1,448 @@
+package audio
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"hash"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/unixpickle/wav"
+)
+
+// flacBlockSize is the number of samples in each FLAC frame, except possibly the last.
+const flacBlockSize = 4096
+
+// flacMaxPartitionOrder limits how finely residuals are split up to pick Rice parameters.
+const flacMaxPartitionOrder = 6
+
+// A flacEncoder produces the frames of a mono 16-bit FLAC stream.
+//
+// Each frame uses whichever fixed linear predictor (order 0 through 4) gives the smallest
+// Rice-coded residual, or a constant or verbatim subframe if that is smaller.
+type flacEncoder struct {
+	sampleRate   int
+	frameNumber  uint64
+	totalSamples uint64
+	minFrameSize int
+	maxFrameSize int
+	md5          hash.Hash
+}
+
+func newFLACEncoder(sampleRate int) *flacEncoder {
+	return &flacEncoder{sampleRate: sampleRate, md5: md5.New()}
+}
+
+// header returns the "fLaC" marker and the STREAMINFO block, using whatever has been learned about
+// the stream so far.
+func (f *flacEncoder) header() []byte {
+	var b flacBitWriter
+	b.write(0x664c6143, 32) // "fLaC"
+	b.write(1, 1)           // last metadata block
+	b.write(0, 7)           // STREAMINFO
+	b.write(34, 24)
+	b.write(flacBlockSize, 16)
+	b.write(flacBlockSize, 16)
+	b.write(uint64(f.minFrameSize), 24)
+	b.write(uint64(f.maxFrameSize), 24)
+	b.write(uint64(f.sampleRate), 20)
+	b.write(0, 3)  // one channel
+	b.write(15, 5) // 16 bits per sample
+	b.write(f.totalSamples, 36)
+	var sum [md5.Size]byte
+	if f.totalSamples > 0 {
+		copy(sum[:], f.md5.Sum(nil))
+	}
+	for _, x := range sum {
+		b.write(uint64(x), 8)
+	}
+	return b.bytes()
+}
+
+// encodeFrame encodes one block of at most flacBlockSize samples.
+func (f *flacEncoder) encodeFrame(block []int16) []byte {
+	var pcm [2]byte
+	for _, x := range block {
+		binary.LittleEndian.PutUint16(pcm[:], uint16(x))
+		f.md5.Write(pcm[:])
+	}
+
+	var b flacBitWriter
+	b.write(0x3ffe, 14) // sync code
+	b.write(0, 1)
+	b.write(0, 1) // fixed block size
+	b.write(7, 4) // block size stored as a 16-bit number at the end of the header
+	rateCode, rateBits, rateValue := f.sampleRateCode()
+	b.write(rateCode, 4)
+	b.write(0, 4) // one channel
+	b.write(4, 3) // 16 bits per sample
+	b.write(0, 1)
+	b.writeUTF8(f.frameNumber)
+	b.write(uint64(len(block)-1), 16)
+	b.write(rateValue, rateBits)
+	b.write(uint64(flacCRC8(b.bytes())), 8)
+
+	writeFLACSubframe(&b, block)
+	b.align()
+	frame := b.bytes()
+	frame = binary.BigEndian.AppendUint16(frame, flacCRC16(frame))
+
+	f.frameNumber++
+	f.totalSamples += uint64(len(block))
+	if f.minFrameSize == 0 || len(frame) < f.minFrameSize {
+		f.minFrameSize = len(frame)
+	}
+	if len(frame) > f.maxFrameSize {
+		f.maxFrameSize = len(frame)
+	}
+	return frame
+}
+
+// sampleRateCode returns the frame header's sample rate code, and the number of bits and value of
+// the sample rate stored at the end of the header, if any.
+func (f *flacEncoder) sampleRateCode() (code uint64, extraBits uint, extra uint64) {
+	codes := map[int]uint64{
+		88200: 1, 176400: 2, 192000: 3, 8000: 4, 16000: 5, 22050: 6, 24000: 7, 32000: 8,
+		44100: 9, 48000: 10, 96000: 11,
+	}
+	if code, ok := codes[f.sampleRate]; ok {
+		return code, 0, 0
+	} else if f.sampleRate <= math.MaxUint16 {
+		return 13, 16, uint64(f.sampleRate)
+	} else if f.sampleRate%10 == 0 && f.sampleRate/10 <= math.MaxUint16 {
+		return 14, 16, uint64(f.sampleRate / 10)
+	}
+	return 0, 0, 0
+}
+
+// writeFLACSubframe writes the smallest subframe that this encoder knows how to produce.
+func writeFLACSubframe(b *flacBitWriter, block []int16) {
+	constant := true
+	for _, x := range block[1:] {
+		if x != block[0] {
+			constant = false
+			break
+		}
+	}
+	if constant {
+		b.write(0, 8) // CONSTANT
+		b.writeSigned(int64(block[0]), 16)
+		return
+	}
+
+	samples := make([]int64, len(block))
+	for i, x := range block {
+		samples[i] = int64(x)
+	}
+
+	bestOrder := -1
+	bestSize := 8 + 16*len(block) // VERBATIM
+	var bestResidual []int64
+	var bestPartitionOrder int
+	var bestParams []uint
+	for order := 0; order <= 4 && order < len(block); order++ {
+		residual := fixedResidual(samples, order)
+		partitionOrder, params, size := chooseRiceParams(residual, len(block), order)
+		size += 8 + 16*order + 6
+		if size < bestSize {
+			bestOrder, bestSize = order, size
+			bestResidual, bestPartitionOrder, bestParams = residual, partitionOrder, params
+		}
+	}
+
+	if bestOrder < 0 {
+		b.write(2, 8) // VERBATIM
+		for _, x := range samples {
+			b.writeSigned(x, 16)
+		}
+		return
+	}
+
+	b.write(uint64(0x08|bestOrder)<<1, 8) // FIXED
+	for _, x := range samples[:bestOrder] {
+		b.writeSigned(x, 16)
+	}
+	b.write(0, 2) // Rice coding with 4-bit parameters
+	b.write(uint64(bestPartitionOrder), 4)
+	partitionSize := len(block) >> uint(bestPartitionOrder)
+	start := 0
+	for i, k := range bestParams {
+		end := (i + 1) * partitionSize
+		b.write(uint64(k), 4)
+		for _, r := range bestResidual[start : end-bestOrder] {
+			b.writeRice(r, k)
+		}
+		start = end - bestOrder
+	}
+}
+
+// fixedResidual computes the prediction error of a fixed polynomial predictor for every sample
+// after the first order samples.
+func fixedResidual(samples []int64, order int) []int64 {
+	res := make([]int64, 0, len(samples)-order)
+	for i := order; i < len(samples); i++ {
+		var prediction int64
+		switch order {
+		case 1:
+			prediction = samples[i-1]
+		case 2:
+			prediction = 2*samples[i-1] - samples[i-2]
+		case 3:
+			prediction = 3*samples[i-1] - 3*samples[i-2] + samples[i-3]
+		case 4:
+			prediction = 4*samples[i-1] - 6*samples[i-2] + 4*samples[i-3] - samples[i-4]
+		}
+		res = append(res, samples[i]-prediction)
+	}
+	return res
+}
+
+// chooseRiceParams finds the partition order and per-partition Rice parameters which minimize the
+// size of a residual, returning the size in bits.
+func chooseRiceParams(residual []int64, blockSize, predictorOrder int) (int, []uint, int) {
+	folded := make([]uint64, len(residual))
+	for i, r := range residual {
+		folded[i] = foldSigned(r)
+	}
+
+	bestSize := -1
+	var bestOrder int
+	var bestParams []uint
+	for order := 0; order <= flacMaxPartitionOrder; order++ {
+		partitionSize := blockSize >> uint(order)
+		if partitionSize<<uint(order) != blockSize || partitionSize <= predictorOrder {
+			break
+		}
+		size := 0
+		params := make([]uint, 1<<uint(order))
+		start := 0
+		for i := range params {
+			end := (i+1)*partitionSize - predictorOrder
+			k, partSize := bestRiceParam(folded[start:end])
+			params[i] = k
+			size += 4 + partSize
+			start = end
+		}
+		if bestSize < 0 || size < bestSize {
+			bestSize, bestOrder, bestParams = size, order, params
+		}
+	}
+	return bestOrder, bestParams, bestSize
+}
+
+// bestRiceParam picks a Rice parameter for some folded residuals, returning it along with the
+// number of bits the residuals take up.
+func bestRiceParam(folded []uint64) (uint, int) {
+	if len(folded) == 0 {
+		return 0, 0
+	}
+	var sum uint64
+	for _, u := range folded {
+		sum += u
+	}
+	estimate := 0
+	if mean := sum / uint64(len(folded)); mean > 0 {
+		estimate = bits.Len64(mean) - 1
+	}
+	if estimate > 14 {
+		estimate = 14
+	}
+
+	bestK := uint(0)
+	bestSize := -1
+	for k := estimate - 1; k <= estimate+1; k++ {
+		if k < 0 || k > 14 {
+			continue
+		}
+		size := len(folded) * (k + 1)
+		for _, u := range folded {
+			size += int(u >> uint(k))
+		}
+		if bestSize < 0 || size < bestSize {
+			bestK, bestSize = uint(k), size
+		}
+	}
+	return bestK, bestSize
+}
+
+func foldSigned(x int64) uint64 {
+	return uint64((x << 1) ^ (x >> 63))
+}
+
+// encodeFLAC writes a complete FLAC file.
+func encodeFLAC(w io.Writer, samples []wav.Sample, sampleRate int) error {
+	enc := newFLACEncoder(sampleRate)
+	pcm := make([]int16, len(samples))
+	for i, s := range samples {
+		pcm[i] = pcm16(s)
+	}
+	var frames []byte
+	for i := 0; i < len(pcm); i += flacBlockSize {
+		end := i + flacBlockSize
+		if end > len(pcm) {
+			end = len(pcm)
+		}
+		frames = append(frames, enc.encodeFrame(pcm[i:end])...)
+	}
+	if _, err := w.Write(enc.header()); err != nil {
+		return err
+	}
+	_, err := w.Write(frames)
+	return err
+}
+
+type flacStreamWriter struct {
+	w            io.Writer
+	enc          *flacEncoder
+	pending      []int16
+	bytesWritten int64
+}
+
+func newFLACStreamWriter(w io.Writer, sampleRate int) (*flacStreamWriter, error) {
+	f := &flacStreamWriter{w: w, enc: newFLACEncoder(sampleRate)}
+	if err := f.write(f.enc.header()); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *flacStreamWriter) WriteSamples(samples []wav.Sample) error {
+	for _, s := range samples {
+		f.pending = append(f.pending, pcm16(s))
+	}
+	for len(f.pending) >= flacBlockSize {
+		if err := f.write(f.enc.encodeFrame(f.pending[:flacBlockSize])); err != nil {
+			return err
+		}
+		f.pending = f.pending[flacBlockSize:]
+	}
+	return nil
+}
+
+// Close encodes any remaining samples, and then fills in the STREAMINFO block if the writer can
+// seek.
+func (f *flacStreamWriter) Close() error {
+	if len(f.pending) > 0 {
+		if err := f.write(f.enc.encodeFrame(f.pending)); err != nil {
+			return err
+		}
+		f.pending = nil
+	}
+	seeker, ok := f.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	end, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+	if _, err := seeker.Seek(end-f.bytesWritten, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := seeker.Write(f.enc.header()); err != nil {
+		return err
+	}
+	_, err = seeker.Seek(end, io.SeekStart)
+	return err
+}
+
+func (f *flacStreamWriter) write(data []byte) error {
+	n, err := f.w.Write(data)
+	f.bytesWritten += int64(n)
+	return err
+}
+
+// A flacBitWriter packs big-endian bit fields into bytes.
+type flacBitWriter struct {
+	buf   []byte
+	cur   uint64
+	nbits uint
+}
+
+func (b *flacBitWriter) write(value uint64, n uint) {
+	for n > 0 {
+		chunk := n
+		if chunk > 32 {
+			chunk = 32
+		}
+		n -= chunk
+		b.cur = b.cur<<chunk | (value>>n)&(1<<chunk-1)
+		b.nbits += chunk
+		for b.nbits >= 8 {
+			b.nbits -= 8
+			b.buf = append(b.buf, byte(b.cur>>b.nbits))
+		}
+		b.cur &= 1<<b.nbits - 1
+	}
+}
+
+func (b *flacBitWriter) writeSigned(value int64, n uint) {
+	b.write(uint64(value)&(1<<n-1), n)
+}
+
+func (b *flacBitWriter) writeRice(value int64, k uint) {
+	u := foldSigned(value)
+	for q := u >> k; q > 0; q-- {
+		b.write(0, 1)
+	}
+	b.write(1, 1)
+	b.write(u&(1<<k-1), k)
+}
+
+// writeUTF8 writes a number with the UTF-8-like variable-length coding used for frame numbers.
+func (b *flacBitWriter) writeUTF8(x uint64) {
+	if x < 0x80 {
+		b.write(x, 8)
+		return
+	}
+	n := 2
+	for x >= 1<<uint(5*n+1) {
+		n++
+	}
+	b.write((0xff00>>uint(n))&0xff|x>>uint(6*(n-1)), 8)
+	for i := n - 2; i >= 0; i-- {
+		b.write(0x80|(x>>uint(6*i))&0x3f, 8)
+	}
+}
+
+func (b *flacBitWriter) align() {
+	if b.nbits > 0 {
+		b.write(0, 8-b.nbits)
+	}
+}
+
+// bytes returns the whole bytes written so far.
+func (b *flacBitWriter) bytes() []byte {
+	return b.buf
+}
+
+func flacCRC8(data []byte) uint8 {
+	var crc uint8
+	for _, x := range data {
+		crc ^= x
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func flacCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, x := range data {
+		crc ^= uint16(x) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,371 @@
+package audio
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/unixpickle/wav"
+)
+
+func TestFLACCRC(t *testing.T) {
+	check := []byte("123456789")
+	if crc := flacCRC8(check); crc != 0xf4 {
+		t.Errorf("expected CRC-8 0xf4 but got %#x", crc)
+	}
+	if crc := flacCRC16(check); crc != 0xfee8 {
+		t.Errorf("expected CRC-16 0xfee8 but got %#x", crc)
+	}
+	if flacCRC8(nil) != 0 || flacCRC16(nil) != 0 {
+		t.Error("expected zero CRCs for empty data")
+	}
+}
+
+func TestFLACWriteUTF8(t *testing.T) {
+	tests := []struct {
+		x        uint64
+		expected []byte
+	}{
+		{0, []byte{0x00}},
+		{0x7f, []byte{0x7f}},
+		{0x80, []byte{0xc2, 0x80}},
+		{0x7ff, []byte{0xdf, 0xbf}},
+		{0x800, []byte{0xe0, 0xa0, 0x80}},
+		{0xffff, []byte{0xef, 0xbf, 0xbf}},
+		{0x10000, []byte{0xf0, 0x90, 0x80, 0x80}},
+		{0x1fffff, []byte{0xf7, 0xbf, 0xbf, 0xbf}},
+		{0x200000, []byte{0xf8, 0x88, 0x80, 0x80, 0x80}},
+		{0x3ffffff, []byte{0xfb, 0xbf, 0xbf, 0xbf, 0xbf}},
+		{0x4000000, []byte{0xfc, 0x84, 0x80, 0x80, 0x80, 0x80}},
+		{0x7fffffff, []byte{0xfd, 0xbf, 0xbf, 0xbf, 0xbf, 0xbf}},
+		{0x80000000, []byte{0xfe, 0x82, 0x80, 0x80, 0x80, 0x80, 0x80}},
+		{1<<36 - 1, []byte{0xfe, 0xbf, 0xbf, 0xbf, 0xbf, 0xbf, 0xbf}},
+	}
+	for _, test := range tests {
+		var b flacBitWriter
+		b.writeUTF8(test.x)
+		if actual := b.bytes(); !bytes.Equal(actual, test.expected) {
+			t.Errorf("%#x: expected %x but got %x", test.x, test.expected, actual)
+		}
+	}
+}
+
+func TestEncodeFLAC(t *testing.T) {
+	tests := map[string][]wav.Sample{
+		"Empty":     nil,
+		"Constant":  constantSamples(flacBlockSize*2+100, 0.25),
+		"Silence":   constantSamples(flacBlockSize, 0),
+		"Short":     testSignal(3),
+		"ShortLast": testSignal(flacBlockSize*2 + 17),
+		"Odd":       testSignal(flacBlockSize + 1001),
+		"Noise":     noiseSamples(flacBlockSize + 5),
+		"Clipped":   constantSamples(10, 2),
+	}
+	for name, samples := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, rate := range []int{22050, 11025, 700000} {
+				var buf bytes.Buffer
+				if err := encodeFLAC(&buf, samples, rate); err != nil {
+					t.Fatal(err)
+				}
+				decoded, decodedRate, err := decodeTestFLAC(buf.Bytes())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decodedRate != rate {
+					t.Errorf("expected sample rate %d but got %d", rate, decodedRate)
+				}
+				if len(decoded) != len(samples) {
+					t.Fatalf("expected %d samples but got %d", len(samples), len(decoded))
+				}
+				for i, s := range samples {
+					if decoded[i] != pcm16(s) {
+						t.Fatalf("sample %d: expected %d but got %d", i, pcm16(s), decoded[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFLACStreamWriter(t *testing.T) {
+	samples := testSignal(flacBlockSize*3 + 123)
+	var expected bytes.Buffer
+	if err := encodeFLAC(&expected, samples, 22050); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &seekBuffer{}
+	w, err := NewStreamWriter(out, FLAC, 22050)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(samples); i += 1000 {
+		end := i + 1000
+		if end > len(samples) {
+			end = len(samples)
+		}
+		if err := w.WriteSamples(samples[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.data, expected.Bytes()) {
+		t.Error("streamed FLAC differs from encodeFLAC")
+	}
+	if out.offset != int64(len(out.data)) {
+		t.Error("stream writer did not seek back to the end")
+	}
+}
+
+func constantSamples(n int, value wav.Sample) []wav.Sample {
+	res := make([]wav.Sample, n)
+	for i := range res {
+		res[i] = value
+	}
+	return res
+}
+
+func testSignal(n int) []wav.Sample {
+	res := make([]wav.Sample, n)
+	for i := range res {
+		res[i] = wav.Sample(0.5*math.Sin(float64(i)*0.05) + 0.2*math.Sin(float64(i)*0.31))
+	}
+	return res
+}
+
+func noiseSamples(n int) []wav.Sample {
+	res := make([]wav.Sample, n)
+	x := uint32(1)
+	for i := range res {
+		x = x*1664525 + 1013904223
+		res[i] = wav.Sample(float64(int32(x)) / math.MaxInt32)
+	}
+	return res
+}
+
+// A seekBuffer is an in-memory io.WriteSeeker.
+type seekBuffer struct {
+	data   []byte
+	offset int64
+}
+
+func (s *seekBuffer) Write(p []byte) (int, error) {
+	if end := s.offset + int64(len(p)); end > int64(len(s.data)) {
+		s.data = append(s.data, make([]byte, end-int64(len(s.data)))...)
+	}
+	copy(s.data[s.offset:], p)
+	s.offset += int64(len(p))
+	return len(p), nil
+}
+
+func (s *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += int64(len(s.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	s.offset = offset
+	return offset, nil
+}
+
+// decodeTestFLAC decodes the subset of FLAC produced by encodeFLAC, checking the CRCs, frame
+// numbers, and STREAMINFO along the way.
+func decodeTestFLAC(data []byte) ([]int16, int, error) {
+	r := &testBitReader{data: data}
+	if r.read(32) != 0x664c6143 {
+		return nil, 0, errors.New("missing fLaC marker")
+	}
+	if r.read(1) != 1 || r.read(7) != 0 || r.read(24) != 34 {
+		return nil, 0, errors.New("unexpected metadata block")
+	}
+	minBlock, maxBlock := r.read(16), r.read(16)
+	minFrame, maxFrame := int(r.read(24)), int(r.read(24))
+	sampleRate := int(r.read(20))
+	if minBlock != flacBlockSize || maxBlock != flacBlockSize || r.read(3) != 0 ||
+		r.read(5) != 15 {
+		return nil, 0, errors.New("unexpected stream parameters")
+	}
+	totalSamples := r.read(36)
+	var expectedMD5 [md5.Size]byte
+	for i := range expectedMD5 {
+		expectedMD5[i] = byte(r.read(8))
+	}
+
+	var res []int16
+	var frameNumber uint64
+	actualMin, actualMax := 0, 0
+	for r.pos/8 < len(data) {
+		start := r.pos / 8
+		if r.read(14) != 0x3ffe || r.read(2) != 0 || r.read(4) != 7 {
+			return nil, 0, errors.New("bad frame header")
+		}
+		rateCode := r.read(4)
+		if r.read(4) != 0 || r.read(3) != 4 || r.read(1) != 0 {
+			return nil, 0, errors.New("bad frame header")
+		}
+		if number := r.readUTF8(); number != frameNumber {
+			return nil, 0, errors.New("wrong frame number")
+		}
+		blockSize := int(r.read(16)) + 1
+		switch rateCode {
+		case 13:
+			if int(r.read(16)) != sampleRate {
+				return nil, 0, errors.New("frame sample rate mismatch")
+			}
+		case 14:
+			if int(r.read(16))*10 != sampleRate {
+				return nil, 0, errors.New("frame sample rate mismatch")
+			}
+		}
+		if crc := flacCRC8(data[start : r.pos/8]); uint8(r.read(8)) != crc {
+			return nil, 0, errors.New("bad header CRC")
+		}
+		block, err := r.readSubframe(blockSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		r.pos = (r.pos + 7) / 8 * 8
+		if crc := flacCRC16(data[start : r.pos/8]); uint16(r.read(16)) != crc {
+			return nil, 0, errors.New("bad frame CRC")
+		}
+		size := r.pos/8 - start
+		if actualMin == 0 || size < actualMin {
+			actualMin = size
+		}
+		if size > actualMax {
+			actualMax = size
+		}
+		res = append(res, block...)
+		frameNumber++
+	}
+
+	if totalSamples != uint64(len(res)) {
+		return nil, 0, errors.New("wrong total sample count")
+	}
+	if minFrame != actualMin || maxFrame != actualMax {
+		return nil, 0, errors.New("wrong frame size range")
+	}
+	var actualMD5 [md5.Size]byte
+	if len(res) > 0 {
+		hash := md5.New()
+		binary.Write(hash, binary.LittleEndian, res)
+		copy(actualMD5[:], hash.Sum(nil))
+	}
+	if actualMD5 != expectedMD5 {
+		return nil, 0, errors.New("MD5 mismatch")
+	}
+	return res, sampleRate, nil
+}
+
+type testBitReader struct {
+	data []byte
+	pos  int
+}
+
+func (t *testBitReader) read(n int) uint64 {
+	var res uint64
+	for i := 0; i < n; i++ {
+		bit := uint64(0)
+		if t.pos/8 < len(t.data) {
+			bit = uint64(t.data[t.pos/8]>>(7-uint(t.pos%8))) & 1
+		}
+		res = res<<1 | bit
+		t.pos++
+	}
+	return res
+}
+
+func (t *testBitReader) readSigned(n int) int64 {
+	x := t.read(n)
+	return int64(x<<(64-uint(n))) >> (64 - uint(n))
+}
+
+func (t *testBitReader) readUTF8() uint64 {
+	first := t.read(8)
+	if first < 0x80 {
+		return first
+	}
+	n := 0
+	for first&(0x80>>uint(n)) != 0 {
+		n++
+	}
+	res := first & (0xff >> uint(n+1))
+	for i := 1; i < n; i++ {
+		res = res<<6 | t.read(8)&0x3f
+	}
+	return res
+}
+
+func (t *testBitReader) readSubframe(blockSize int) ([]int16, error) {
+	header := t.read(8)
+	samples := make([]int64, blockSize)
+	switch {
+	case header == 0:
+		value := t.readSigned(16)
+		for i := range samples {
+			samples[i] = value
+		}
+	case header == 2:
+		for i := range samples {
+			samples[i] = t.readSigned(16)
+		}
+	case header>>4 == 1 && (header>>1)&7 <= 4:
+		order := int(header>>1) & 7
+		for i := 0; i < order; i++ {
+			samples[i] = t.readSigned(16)
+		}
+		if t.read(2) != 0 {
+			return nil, errors.New("unexpected residual coding")
+		}
+		partitionOrder := int(t.read(4))
+		partitionSize := blockSize >> uint(partitionOrder)
+		i := order
+		for p := 0; p < 1<<uint(partitionOrder); p++ {
+			k := uint(t.read(4))
+			for ; i < (p+1)*partitionSize; i++ {
+				var q uint64
+				for t.read(1) == 0 {
+					q++
+				}
+				u := q<<k | t.read(int(k))
+				residual := int64(u>>1) ^ -int64(u&1)
+				samples[i] = residual + testFixedPrediction(samples, i, order)
+			}
+		}
+	default:
+		return nil, errors.New("unexpected subframe type")
+	}
+	res := make([]int16, blockSize)
+	for i, x := range samples {
+		if x < math.MinInt16 || x > math.MaxInt16 {
+			return nil, errors.New("sample out of range")
+		}
+		res[i] = int16(x)
+	}
+	return res, nil
+}
+
+func testFixedPrediction(s []int64, i, order int) int64 {
+	switch order {
+	case 1:
+		return s[i-1]
+	case 2:
+		return 2*s[i-1] - s[i-2]
+	case 3:
+		return 3*s[i-1] - 3*s[i-2] + s[i-3]
+	case 4:
+		return 4*s[i-1] - 6*s[i-2] + 4*s[i-3] - s[i-4]
+	}
+	return 0
+}
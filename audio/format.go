@@ -0,0 +1,232 @@
+// Package audio encodes synthesized speech in various file formats.
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/unixpickle/wav"
+)
+
+// A Format is an encoding for mono audio.
+type Format string
+
+const (
+	// WAV is a WAVE file with 16-bit linear PCM samples.
+	WAV Format = "wav"
+
+	// PCM is raw signed 16-bit little-endian PCM with no header.
+	PCM Format = "pcm"
+
+	// FLAC is a losslessly compressed FLAC file with 16-bit samples.
+	FLAC Format = "flac"
+
+	// MuLaw is raw 8 kHz G.711 μ-law, as used by North American and Japanese telephony.
+	MuLaw Format = "ulaw"
+
+	// ALaw is raw 8 kHz G.711 A-law, as used by European telephony.
+	ALaw Format = "alaw"
+
+	// MuLawWAV is a WAVE file with 8 kHz G.711 μ-law samples.
+	MuLawWAV Format = "wav-ulaw"
+
+	// ALawWAV is a WAVE file with 8 kHz G.711 A-law samples.
+	ALawWAV Format = "wav-alaw"
+)
+
+// TelephonySampleRate is the sample rate of the G.711 formats.
+const TelephonySampleRate = 8000
+
+// Formats lists every supported format.
+var Formats = []Format{WAV, PCM, FLAC, MuLaw, ALaw, MuLawWAV, ALawWAV}
+
+// ParseFormat finds the format with a given name.
+func ParseFormat(name string) (Format, error) {
+	for _, f := range Formats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+	return "", errors.New("unknown audio format: " + name)
+}
+
+// ContentType returns the MIME type for the format.
+func (f Format) ContentType() string {
+	switch f {
+	case WAV, MuLawWAV, ALawWAV:
+		return "audio/wav"
+	case FLAC:
+		return "audio/flac"
+	case MuLaw:
+		return "audio/basic"
+	case ALaw:
+		return "audio/x-alaw-basic"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Extension returns the usual file extension for the format, including the leading dot.
+func (f Format) Extension() string {
+	switch f {
+	case MuLaw:
+		return ".ul"
+	case ALaw:
+		return ".al"
+	case MuLawWAV, ALawWAV:
+		return ".wav"
+	default:
+		return "." + string(f)
+	}
+}
+
+// SampleRate returns the sample rate of the encoded audio, given the sample rate of the samples
+// being encoded.
+// The G.711 formats are always 8 kHz, and other formats keep the original rate.
+func (f Format) SampleRate(inputRate int) int {
+	switch f {
+	case MuLaw, ALaw, MuLawWAV, ALawWAV:
+		return TelephonySampleRate
+	default:
+		return inputRate
+	}
+}
+
+func (f Format) encoding() sampleEncoding {
+	switch f {
+	case MuLaw, MuLawWAV:
+		return muLawEncoding
+	case ALaw, ALawWAV:
+		return aLawEncoding
+	default:
+		return linear16Encoding
+	}
+}
+
+// Encode writes mono samples to w in the given format.
+// The samples are resampled if the format requires a different sample rate.
+func Encode(w io.Writer, f Format, samples []wav.Sample, sampleRate int) error {
+	if outRate := f.SampleRate(sampleRate); outRate != sampleRate {
+		samples = Resample(samples, sampleRate, outRate)
+		sampleRate = outRate
+	}
+	enc := f.encoding()
+	switch f {
+	case WAV, MuLawWAV, ALawWAV:
+		data := enc.encode(samples)
+		if err := writeWAVHeader(w, enc, sampleRate, uint32(len(data))); err != nil {
+			return err
+		}
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+		_, err := w.Write(data)
+		return err
+	case PCM, MuLaw, ALaw:
+		_, err := w.Write(enc.encode(samples))
+		return err
+	case FLAC:
+		return encodeFLAC(w, samples, sampleRate)
+	default:
+		return errors.New("unknown audio format: " + string(f))
+	}
+}
+
+// A sampleEncoding is a way of storing individual samples as bytes.
+type sampleEncoding int
+
+const (
+	linear16Encoding sampleEncoding = iota
+	muLawEncoding
+	aLawEncoding
+)
+
+func (s sampleEncoding) bytesPerSample() int {
+	if s == linear16Encoding {
+		return 2
+	}
+	return 1
+}
+
+// wavFormatTag returns the value of the format field in a WAVE file's format chunk.
+func (s sampleEncoding) wavFormatTag() uint16 {
+	switch s {
+	case muLawEncoding:
+		return 7
+	case aLawEncoding:
+		return 6
+	default:
+		return 1
+	}
+}
+
+func (s sampleEncoding) encode(samples []wav.Sample) []byte {
+	buf := make([]byte, len(samples)*s.bytesPerSample())
+	for i, sample := range samples {
+		switch s {
+		case linear16Encoding:
+			binary.LittleEndian.PutUint16(buf[i*2:], uint16(pcm16(sample)))
+		case muLawEncoding:
+			buf[i] = linearToMuLaw(pcm16(sample))
+		case aLawEncoding:
+			buf[i] = linearToALaw(pcm16(sample))
+		}
+	}
+	return buf
+}
+
+// wavHeaderSize returns the number of bytes before the samples in a WAVE file.
+// Files with compressed samples have a longer format chunk and a fact chunk.
+func wavHeaderSize(enc sampleEncoding) int {
+	if enc == linear16Encoding {
+		return 44
+	}
+	return 58
+}
+
+// writeWAVHeader writes the RIFF header, format chunk, fact chunk if needed, and data chunk header
+// for a mono WAVE file with dataSize bytes of samples.
+//
+// RIFF chunks have an even length, so if dataSize is odd, the data must be followed by a zero
+// pad byte, which the RIFF size includes.
+func writeWAVHeader(w io.Writer, enc sampleEncoding, sampleRate int, dataSize uint32) error {
+	headerSize := wavHeaderSize(enc)
+	riffSize := dataSize + dataSize%2 + uint32(headerSize-8)
+	if dataSize > math.MaxUint32-uint32(headerSize-8)-1 {
+		riffSize = math.MaxUint32
+	}
+	bytesPerSample := enc.bytesPerSample()
+	header := make([]byte, 0, headerSize)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, riffSize)
+	header = append(header, "WAVEfmt "...)
+	if enc == linear16Encoding {
+		header = binary.LittleEndian.AppendUint32(header, 16)
+	} else {
+		header = binary.LittleEndian.AppendUint32(header, 18)
+	}
+	header = binary.LittleEndian.AppendUint16(header, enc.wavFormatTag())
+	header = binary.LittleEndian.AppendUint16(header, 1)
+	header = binary.LittleEndian.AppendUint32(header, uint32(sampleRate))
+	header = binary.LittleEndian.AppendUint32(header, uint32(sampleRate*bytesPerSample))
+	header = binary.LittleEndian.AppendUint16(header, uint16(bytesPerSample))
+	header = binary.LittleEndian.AppendUint16(header, uint16(bytesPerSample*8))
+	if enc != linear16Encoding {
+		header = binary.LittleEndian.AppendUint16(header, 0)
+		header = append(header, "fact"...)
+		header = binary.LittleEndian.AppendUint32(header, 4)
+		header = binary.LittleEndian.AppendUint32(header, dataSize/uint32(bytesPerSample))
+	}
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, dataSize)
+	_, err := w.Write(header)
+	return err
+}
+
+// pcm16 converts a sample to a clipped 16-bit integer.
+func pcm16(s wav.Sample) int16 {
+	v := math.Round(float64(s) * math.MaxInt16)
+	return int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, v)))
+}
@@ -0,0 +1,59 @@
+package audio
+
+// linearToMuLaw compresses a 16-bit sample with G.711 μ-law.
+func linearToMuLaw(sample int16) byte {
+	const bias = 0x84 >> 2
+	const clip = 8159
+
+	// Negative samples use their one's complement, as in the ITU-T reference implementation,
+	// so that -1 is encoded as negative zero.
+	value := int(sample) >> 2
+	mask := 0xff
+	if value < 0 {
+		value = -value - 1
+		mask = 0x7f
+	}
+	if value > clip {
+		value = clip
+	}
+	value += bias
+
+	segment := g711Segment(value, 0x3f)
+	if segment >= 8 {
+		return byte(0x7f ^ mask)
+	}
+	return byte((segment<<4 | (value>>uint(segment+1))&0xf) ^ mask)
+}
+
+// linearToALaw compresses a 16-bit sample with G.711 A-law.
+func linearToALaw(sample int16) byte {
+	value := int(sample) >> 3
+	mask := 0xd5
+	if value < 0 {
+		value = -value - 1
+		mask = 0x55
+	}
+
+	segment := g711Segment(value, 0x1f)
+	if segment >= 8 {
+		return byte(0x7f ^ mask)
+	}
+	encoded := segment << 4
+	if segment < 2 {
+		encoded |= (value >> 1) & 0xf
+	} else {
+		encoded |= (value >> uint(segment)) & 0xf
+	}
+	return byte(encoded ^ mask)
+}
+
+// g711Segment finds the logarithmic segment of a value, where the first segment ends at
+// firstEnd and each following segment is twice as long.
+func g711Segment(value, firstEnd int) int {
+	for segment := 0; segment < 8; segment++ {
+		if value <= (firstEnd+1)<<uint(segment)-1 {
+			return segment
+		}
+	}
+	return 8
+}
@@ -0,0 +1,84 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestG711Vectors(t *testing.T) {
+	tests := []struct {
+		sample int16
+		muLaw  byte
+		aLaw   byte
+	}{
+		{0, 0xff, 0xd5},
+		{1, 0xff, 0xd5},
+		{-1, 0x7f, 0x55},
+		{32767, 0x80, 0xaa},
+		{-32767, 0x00, 0x2a},
+		{-32768, 0x00, 0x2a},
+	}
+	for _, test := range tests {
+		if actual := linearToMuLaw(test.sample); actual != test.muLaw {
+			t.Errorf("μ-law of %d: expected %#02x but got %#02x", test.sample, test.muLaw, actual)
+		}
+		if actual := linearToALaw(test.sample); actual != test.aLaw {
+			t.Errorf("A-law of %d: expected %#02x but got %#02x", test.sample, test.aLaw, actual)
+		}
+	}
+}
+
+func TestG711Reference(t *testing.T) {
+	for x := math.MinInt16; x <= math.MaxInt16; x++ {
+		sample := int16(x)
+		if actual, expected := linearToMuLaw(sample), referenceMuLaw(sample); actual != expected {
+			t.Fatalf("μ-law of %d: expected %#02x but got %#02x", x, expected, actual)
+		}
+		if actual, expected := linearToALaw(sample), referenceALaw(sample); actual != expected {
+			t.Fatalf("A-law of %d: expected %#02x but got %#02x", x, expected, actual)
+		}
+	}
+}
+
+// referenceMuLaw is ulaw_compress from the ITU-T G.191 software tools.
+func referenceMuLaw(x int16) byte {
+	absno := int(x>>2) + 33
+	if x < 0 {
+		absno = int(^x>>2) + 33
+	}
+	if absno > 0x1fff {
+		absno = 0x1fff
+	}
+	segno := 1
+	for i := absno >> 6; i != 0; i >>= 1 {
+		segno++
+	}
+	highNibble := 8 - segno
+	lowNibble := 0xf - (absno>>uint(segno))&0xf
+	res := highNibble<<4 | lowNibble
+	if x >= 0 {
+		res |= 0x80
+	}
+	return byte(res)
+}
+
+// referenceALaw is alaw_compress from the ITU-T G.191 software tools.
+func referenceALaw(x int16) byte {
+	ix := int(x >> 4)
+	if x < 0 {
+		ix = int(^x >> 4)
+	}
+	if ix > 15 {
+		exp := 1
+		for ix > 16+15 {
+			ix >>= 1
+			exp++
+		}
+		ix -= 16
+		ix += exp << 4
+	}
+	if x >= 0 {
+		ix |= 0x80
+	}
+	return byte(ix ^ 0x55)
+}
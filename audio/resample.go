@@ -0,0 +1,124 @@
+package audio
+
+import (
+	"math"
+
+	"github.com/unixpickle/wav"
+)
+
+// resampleZeroCrossings is the number of zero crossings of the sinc filter on each side of its
+// center, which trades off speed for the sharpness of the low-pass filter.
+const resampleZeroCrossings = 16
+
+// resampleCutoff is the low-pass cutoff as a fraction of the lower Nyquist frequency, leaving
+// room for the filter's transition band.
+const resampleCutoff = 0.95
+
+// A Resampler converts a stream of samples from one sample rate to another with a windowed sinc
+// filter, which also removes frequencies too high for the new sample rate.
+type Resampler struct {
+	fromRate int
+	toRate   int
+
+	// cutoff is the filter's cutoff as a fraction of the input's Nyquist frequency, and
+	// halfWidth is the filter's reach on either side of its center, in input samples.
+	cutoff    float64
+	halfWidth float64
+
+	// buffer holds the input samples that later output samples still depend on.
+	// Its first sample is input sample number bufferStart.
+	buffer      []float64
+	bufferStart int
+
+	inputCount  int
+	outputCount int
+}
+
+// NewResampler creates a Resampler between two sample rates.
+func NewResampler(fromRate, toRate int) *Resampler {
+	cutoff := resampleCutoff * math.Min(1, float64(toRate)/float64(fromRate))
+	return &Resampler{
+		fromRate:  fromRate,
+		toRate:    toRate,
+		cutoff:    cutoff,
+		halfWidth: resampleZeroCrossings / cutoff,
+	}
+}
+
+// Resample converts a complete signal from one sample rate to another.
+func Resample(samples []wav.Sample, fromRate, toRate int) []wav.Sample {
+	r := NewResampler(fromRate, toRate)
+	return append(r.Write(samples), r.Flush()...)
+}
+
+// Write adds input samples and returns as many output samples as can now be computed.
+func (r *Resampler) Write(samples []wav.Sample) []wav.Sample {
+	for _, s := range samples {
+		r.buffer = append(r.buffer, float64(s))
+	}
+	r.inputCount += len(samples)
+	return r.output(false)
+}
+
+// Flush returns the remaining output samples, treating the input as silent after its end.
+func (r *Resampler) Flush() []wav.Sample {
+	return r.output(true)
+}
+
+func (r *Resampler) output(final bool) []wav.Sample {
+	var res []wav.Sample
+	totalOutputs := int(math.Ceil(float64(r.inputCount) * float64(r.toRate) /
+		float64(r.fromRate)))
+	for !final || r.outputCount < totalOutputs {
+		center := float64(r.outputCount) * float64(r.fromRate) / float64(r.toRate)
+		last := int(math.Floor(center + r.halfWidth))
+		if !final && last >= r.inputCount {
+			break
+		}
+		res = append(res, wav.Sample(r.filter(center)))
+		r.outputCount++
+	}
+
+	// Drop the samples that no future output will use.
+	nextCenter := float64(r.outputCount) * float64(r.fromRate) / float64(r.toRate)
+	if first := int(math.Ceil(nextCenter - r.halfWidth)); first > r.bufferStart {
+		drop := first - r.bufferStart
+		if drop > len(r.buffer) {
+			drop = len(r.buffer)
+		}
+		r.buffer = r.buffer[drop:]
+		r.bufferStart += drop
+	}
+	return res
+}
+
+// filter computes the low-passed signal at a position measured in input samples.
+func (r *Resampler) filter(center float64) float64 {
+	first := int(math.Ceil(center - r.halfWidth))
+	last := int(math.Floor(center + r.halfWidth))
+	var sum float64
+	for i := first; i <= last; i++ {
+		idx := i - r.bufferStart
+		if idx < 0 || idx >= len(r.buffer) {
+			continue
+		}
+		offset := float64(i) - center
+		sum += r.buffer[idx] * r.cutoff * sinc(r.cutoff*offset) * blackman(offset/r.halfWidth)
+	}
+	return sum
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman evaluates a Blackman window which spans x from -1 to 1.
+func blackman(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	return 0.42 + 0.5*math.Cos(math.Pi*x) + 0.08*math.Cos(2*math.Pi*x)
+}
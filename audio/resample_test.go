@@ -0,0 +1,72 @@
+package audio
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/wav"
+)
+
+var resampleRates = [][2]int{{22050, 8000}, {8000, 22050}, {44100, 48000}, {48000, 44100},
+	{16000, 8000}, {22050, 22050}}
+
+func TestResampleLength(t *testing.T) {
+	for _, rates := range resampleRates {
+		for _, n := range []int{0, 1, 2, 99, 1000, 4097} {
+			actual := len(Resample(testSignal(n), rates[0], rates[1]))
+			expected := int(math.Ceil(float64(n) * float64(rates[1]) / float64(rates[0])))
+			if actual != expected {
+				t.Errorf("%d samples from %d to %d Hz: expected %d outputs but got %d", n,
+					rates[0], rates[1], expected, actual)
+			}
+		}
+	}
+}
+
+func TestResamplerChunks(t *testing.T) {
+	samples := testSignal(5000)
+	for _, rates := range resampleRates {
+		expected := Resample(samples, rates[0], rates[1])
+		for _, chunkSize := range []int{1, 7, 100, 4096} {
+			r := NewResampler(rates[0], rates[1])
+			var actual []wav.Sample
+			for i := 0; i < len(samples); i += chunkSize {
+				end := i + chunkSize
+				if end > len(samples) {
+					end = len(samples)
+				}
+				actual = append(actual, r.Write(samples[i:end])...)
+			}
+			actual = append(actual, r.Flush()...)
+			if len(actual) != len(expected) {
+				t.Errorf("%d to %d Hz in chunks of %d: expected %d outputs but got %d",
+					rates[0], rates[1], chunkSize, len(expected), len(actual))
+				continue
+			}
+			for i, s := range expected {
+				if actual[i] != s {
+					t.Errorf("%d to %d Hz in chunks of %d: sample %d differs", rates[0],
+						rates[1], chunkSize, i)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestResampleLowPass(t *testing.T) {
+	// A tone above the new Nyquist frequency should be removed almost entirely.
+	samples := make([]wav.Sample, 22050)
+	for i := range samples {
+		samples[i] = wav.Sample(math.Sin(2 * math.Pi * 6000 * float64(i) / 22050))
+	}
+	var peak float64
+	output := Resample(samples, 22050, 8000)
+	// The edges are skipped, since the filter treats the signal as silent outside of it.
+	for _, s := range output[100 : len(output)-100] {
+		peak = math.Max(peak, math.Abs(float64(s)))
+	}
+	if peak > 0.01 {
+		t.Errorf("expected the tone to be filtered out, but its peak is %f", peak)
+	}
+}
@@ -0,0 +1,128 @@
+package audio
+
+import (
+	"errors"
+	"io"
+	"math"
+
+	"github.com/unixpickle/wav"
+)
+
+// A StreamWriter encodes audio incrementally, before its total length is known.
+type StreamWriter interface {
+	// WriteSamples encodes more mono samples.
+	WriteSamples(samples []wav.Sample) error
+
+	// Close finishes the stream.
+	// It does not close the underlying writer.
+	Close() error
+}
+
+// NewStreamWriter creates a StreamWriter for a format.
+//
+// Any header is written immediately.
+// If the format's header records the length of the audio and w is an io.WriteSeeker, Close
+// seeks back to fill in the length; otherwise, the length is left as the largest possible value,
+// which is the usual convention for streamed audio.
+// Like Encode, the writer resamples the audio if the format requires a different sample rate.
+func NewStreamWriter(w io.Writer, f Format, sampleRate int) (StreamWriter, error) {
+	outRate := f.SampleRate(sampleRate)
+	var res StreamWriter
+	switch f {
+	case WAV, MuLawWAV, ALawWAV:
+		enc := f.encoding()
+		if err := writeWAVHeader(w, enc, outRate, math.MaxUint32); err != nil {
+			return nil, err
+		}
+		res = &wavStreamWriter{w: w, encoding: enc, sampleRate: outRate}
+	case PCM, MuLaw, ALaw:
+		res = &rawStreamWriter{w: w, encoding: f.encoding()}
+	case FLAC:
+		var err error
+		res, err = newFLACStreamWriter(w, outRate)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unknown audio format: " + string(f))
+	}
+	if outRate != sampleRate {
+		res = &resamplingStreamWriter{
+			StreamWriter: res,
+			resampler:    NewResampler(sampleRate, outRate),
+		}
+	}
+	return res, nil
+}
+
+type rawStreamWriter struct {
+	w        io.Writer
+	encoding sampleEncoding
+}
+
+func (r *rawStreamWriter) WriteSamples(samples []wav.Sample) error {
+	_, err := r.w.Write(r.encoding.encode(samples))
+	return err
+}
+
+func (r *rawStreamWriter) Close() error {
+	return nil
+}
+
+type wavStreamWriter struct {
+	w          io.Writer
+	encoding   sampleEncoding
+	sampleRate int
+	dataSize   int64
+}
+
+func (w *wavStreamWriter) WriteSamples(samples []wav.Sample) error {
+	data := w.encoding.encode(samples)
+	w.dataSize += int64(len(data))
+	_, err := w.w.Write(data)
+	return err
+}
+
+func (w *wavStreamWriter) Close() error {
+	padding := w.dataSize % 2
+	if padding == 1 {
+		if _, err := w.w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	seeker, ok := w.w.(io.WriteSeeker)
+	if !ok || w.dataSize > math.MaxUint32 {
+		return nil
+	}
+	end, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		// Some writers, like pipes, implement io.Seeker but cannot seek.
+		return nil
+	}
+	start := end - padding - w.dataSize - int64(wavHeaderSize(w.encoding))
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	if err := writeWAVHeader(seeker, w.encoding, w.sampleRate, uint32(w.dataSize)); err != nil {
+		return err
+	}
+	_, err = seeker.Seek(end, io.SeekStart)
+	return err
+}
+
+// A resamplingStreamWriter converts samples to another sample rate before passing them on.
+type resamplingStreamWriter struct {
+	StreamWriter
+	resampler *Resampler
+}
+
+func (r *resamplingStreamWriter) WriteSamples(samples []wav.Sample) error {
+	return r.StreamWriter.WriteSamples(r.resampler.Write(samples))
+}
+
+func (r *resamplingStreamWriter) Close() error {
+	if err := r.StreamWriter.WriteSamples(r.resampler.Flush()); err != nil {
+		return err
+	}
+	return r.StreamWriter.Close()
+}
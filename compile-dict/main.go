@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/unixpickle/gospeech"
+)
+
+func main() {
+	args := os.Args[1:]
+	var arpabet bool
+	if len(args) == 3 && args[0] == "-arpabet" {
+		arpabet = true
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: compile-dict [-arpabet] <dictionary.txt> <output.gsd>")
+		os.Exit(1)
+	}
+
+	var dict gospeech.Dictionary
+	var err error
+	if arpabet {
+		dict, err = gospeech.LoadARPAbetDictionary(args[0])
+	} else {
+		dict, err = gospeech.LoadDictionary(args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	f, err := os.Create(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := dict.WriteCompiled(f); err != nil {
+		f.Close()
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println("Compiled", len(dict), "words into", args[1])
+}
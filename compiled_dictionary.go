@@ -0,0 +1,354 @@
+package gospeech
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// compiledMagic starts every compiled dictionary.
+// The final byte is the format version.
+var compiledMagic = []byte("GSPD\x01")
+
+var errCorruptDictionary = errors.New("corrupt compiled dictionary")
+
+// compiledBlockSize is the number of entries in each front-coded block of a compiled dictionary.
+const compiledBlockSize = 32
+
+// A CompiledDictionary is a read-only dictionary stored in a compact binary format.
+//
+// Words are sorted and front-coded in blocks, and an index of block offsets allows lookups with
+// a binary search, so the dictionary is never expanded into a map.
+// Pronunciations are stored with one byte per IPA symbol.
+// Compiled dictionaries are created with Dictionary.WriteCompiled.
+type CompiledDictionary struct {
+	entryCount int
+	symbols    []string
+	offsets    []byte
+	blocks     []byte
+}
+
+// NewCompiledDictionary reads a compiled dictionary from its binary representation.
+// The data is used directly rather than copied, which makes this suitable for data embedded
+// with go:embed.
+func NewCompiledDictionary(data []byte) (*CompiledDictionary, error) {
+	if !IsCompiledDictionary(data) {
+		return nil, errors.New("not a compiled dictionary")
+	}
+	r := bytes.NewReader(data[len(compiledMagic):])
+	entryCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	symbolCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if symbolCount > 256 {
+		return nil, errCorruptDictionary
+	}
+	symbols := make([]string, symbolCount)
+	for i := range symbols {
+		symbol, _, err := r.ReadRune()
+		if err != nil {
+			return nil, err
+		}
+		symbols[i] = string(symbol)
+	}
+	blockCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	header := len(data) - r.Len()
+	if uint64(len(data)-header)/4 < blockCount {
+		return nil, errors.New("truncated compiled dictionary")
+	}
+	// Every block but the last holds exactly compiledBlockSize entries.
+	expectedBlocks := entryCount / compiledBlockSize
+	if entryCount%compiledBlockSize != 0 {
+		expectedBlocks++
+	}
+	if blockCount != expectedBlocks {
+		return nil, errCorruptDictionary
+	}
+	res := &CompiledDictionary{
+		entryCount: int(entryCount),
+		symbols:    symbols,
+		offsets:    data[header : header+int(blockCount)*4],
+		blocks:     data[header+int(blockCount)*4:],
+	}
+	if err := res.validateIndex(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// LoadCompiledDictionary reads a compiled dictionary file.
+func LoadCompiledDictionary(path string) (*CompiledDictionary, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewCompiledDictionary(contents)
+}
+
+// LoadCompiledDictionaryFS reads a compiled dictionary file from a file system, such as an
+// embed.FS.
+func LoadCompiledDictionaryFS(fsys fs.FS, name string) (*CompiledDictionary, error) {
+	contents, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return NewCompiledDictionary(contents)
+}
+
+// IsCompiledDictionary checks if some data starts like a compiled dictionary.
+func IsCompiledDictionary(data []byte) bool {
+	return bytes.HasPrefix(data, compiledMagic)
+}
+
+// Len returns the number of words in the dictionary.
+func (c *CompiledDictionary) Len() int {
+	return c.entryCount
+}
+
+// Pronunciations returns every pronunciation of a word, default first.
+//
+// Only the block which could contain the word is decoded.
+// Since blocks are not fully checked when the dictionary is loaded, a corrupt block acts as if
+// it does not contain the word.
+func (c *CompiledDictionary) Pronunciations(word string) []Pronunciation {
+	// Find the last block whose first word is not greater than the word.
+	idx := sort.Search(c.blockCount(), func(i int) bool {
+		head, _ := c.blockHead(i)
+		return string(head) > word
+	}) - 1
+	if idx < 0 {
+		return nil
+	}
+
+	offset, end := c.blockBounds(idx)
+	var key string
+	for offset < end {
+		var pronOffset int
+		var err error
+		key, pronOffset, offset, err = c.decodeEntry(offset, end, key)
+		if err != nil || key > word {
+			break
+		} else if key == word {
+			prons, err := c.decodePronunciations(pronOffset, end)
+			if err != nil {
+				return nil
+			}
+			return prons
+		}
+	}
+	return nil
+}
+
+// TranslateToIPA is like Dictionary.TranslateToIPA.
+func (c *CompiledDictionary) TranslateToIPA(text string) string {
+	return translateToIPA(c, text)
+}
+
+func (c *CompiledDictionary) blockCount() int {
+	return len(c.offsets) / 4
+}
+
+// blockBounds returns the offsets of the start and end of a block.
+func (c *CompiledDictionary) blockBounds(i int) (start, end int) {
+	start = int(binary.LittleEndian.Uint32(c.offsets[i*4:]))
+	end = len(c.blocks)
+	if i+1 < c.blockCount() {
+		end = int(binary.LittleEndian.Uint32(c.offsets[(i+1)*4:]))
+	}
+	return
+}
+
+// blockHead returns the first word in a block, which is stored without a shared prefix.
+func (c *CompiledDictionary) blockHead(i int) ([]byte, error) {
+	offset, end := c.blockBounds(i)
+	shared, offset, err := c.checkUvarint(offset, end)
+	if err != nil || shared != 0 {
+		return nil, errCorruptDictionary
+	}
+	head, _, err := c.checkBytes(offset, end)
+	return head, err
+}
+
+// validateIndex checks that the blocks are in order and that every block starts with a word
+// which sorts after the first word of the previous block, so that Pronunciations can search
+// the blocks safely.
+// The rest of each block is checked as it is decoded.
+func (c *CompiledDictionary) validateIndex() error {
+	var lastHead []byte
+	for i := 0; i < c.blockCount(); i++ {
+		start, end := c.blockBounds(i)
+		if start >= end || end > len(c.blocks) {
+			return errCorruptDictionary
+		}
+		head, err := c.blockHead(i)
+		if err != nil {
+			return err
+		}
+		if i > 0 && bytes.Compare(head, lastHead) <= 0 {
+			return errors.New("compiled dictionary is not sorted")
+		}
+		lastHead = head
+	}
+	return nil
+}
+
+// decodeEntry decodes the word at an offset, given the previous word in the block.
+// It returns the word, the offset of the word's pronunciations, and the offset of the next entry.
+func (c *CompiledDictionary) decodeEntry(offset, end int, last string) (word string, pronOffset,
+	next int, err error) {
+	shared, offset, err := c.checkUvarint(offset, end)
+	if err != nil || shared > uint64(len(last)) {
+		return "", 0, 0, errCorruptDictionary
+	}
+	suffix, offset, err := c.checkBytes(offset, end)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	word = last[:shared] + string(suffix)
+
+	pronOffset = offset
+	count, offset, err := c.checkUvarint(offset, end)
+	if err != nil || count > uint64(end-offset) {
+		return "", 0, 0, errCorruptDictionary
+	}
+	for i := 0; i < int(count)*2; i++ {
+		if _, offset, err = c.checkBytes(offset, end); err != nil {
+			return "", 0, 0, err
+		}
+	}
+	return word, pronOffset, offset, nil
+}
+
+func (c *CompiledDictionary) decodePronunciations(offset, end int) ([]Pronunciation, error) {
+	count, offset, err := c.checkUvarint(offset, end)
+	if err != nil || count > uint64(end-offset) {
+		return nil, errCorruptDictionary
+	}
+	res := make([]Pronunciation, count)
+	for i := range res {
+		var encodedIPA, pos []byte
+		if encodedIPA, offset, err = c.checkBytes(offset, end); err != nil {
+			return nil, err
+		}
+		if pos, offset, err = c.checkBytes(offset, end); err != nil {
+			return nil, err
+		}
+		var ipa strings.Builder
+		for _, symbol := range encodedIPA {
+			if int(symbol) >= len(c.symbols) {
+				return nil, errCorruptDictionary
+			}
+			ipa.WriteString(c.symbols[symbol])
+		}
+		res[i] = Pronunciation{IPA: ipa.String(), POS: PartOfSpeech(pos)}
+	}
+	return res, nil
+}
+
+// checkUvarint is like binary.Uvarint, but it fails if the number does not end before end.
+func (c *CompiledDictionary) checkUvarint(offset, end int) (uint64, int, error) {
+	x, n := binary.Uvarint(c.blocks[offset:end])
+	if n <= 0 {
+		return 0, 0, errCorruptDictionary
+	}
+	return x, offset + n, nil
+}
+
+// checkBytes decodes a length-prefixed string, failing if it does not end before end.
+func (c *CompiledDictionary) checkBytes(offset, end int) ([]byte, int, error) {
+	length, offset, err := c.checkUvarint(offset, end)
+	if err != nil || length > uint64(end-offset) {
+		return nil, 0, errCorruptDictionary
+	}
+	return c.blocks[offset : offset+int(length)], offset + int(length), nil
+}
+
+// WriteCompiled encodes the dictionary in the format read by NewCompiledDictionary.
+func (d Dictionary) WriteCompiled(w io.Writer) error {
+	words := make([]string, 0, len(d))
+	for word := range d {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	symbolIndices := map[rune]int{}
+	var symbols []rune
+	for _, word := range words {
+		for _, p := range d[word] {
+			for _, r := range p.IPA {
+				if _, ok := symbolIndices[r]; !ok {
+					symbolIndices[r] = len(symbols)
+					symbols = append(symbols, r)
+				}
+			}
+		}
+	}
+	if len(symbols) > 256 {
+		return errors.New("too many distinct IPA symbols to compile")
+	}
+
+	var blocks bytes.Buffer
+	var offsets []byte
+	var last string
+	for i, word := range words {
+		if i%compiledBlockSize == 0 {
+			offsets = binary.LittleEndian.AppendUint32(offsets, uint32(blocks.Len()))
+			last = ""
+		}
+		shared := 0
+		for shared < len(word) && shared < len(last) && word[shared] == last[shared] {
+			shared++
+		}
+		writeUvarint(&blocks, uint64(shared))
+		writeCompiledString(&blocks, word[shared:])
+		prons := d[word]
+		writeUvarint(&blocks, uint64(len(prons)))
+		for _, p := range prons {
+			var encodedIPA []byte
+			for _, r := range p.IPA {
+				encodedIPA = append(encodedIPA, byte(symbolIndices[r]))
+			}
+			writeCompiledString(&blocks, string(encodedIPA))
+			writeCompiledString(&blocks, string(p.POS))
+		}
+		last = word
+	}
+	if blocks.Len() > 1<<32-1 {
+		return errors.New("dictionary too large to compile")
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(compiledMagic)
+	writeUvarint(bw, uint64(len(words)))
+	writeUvarint(bw, uint64(len(symbols)))
+	for _, r := range symbols {
+		bw.WriteRune(r)
+	}
+	writeUvarint(bw, uint64(len(offsets)/4))
+	bw.Write(offsets)
+	bw.Write(blocks.Bytes())
+	return bw.Flush()
+}
+
+func writeUvarint(w io.Writer, x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], x)])
+}
+
+func writeCompiledString(w io.Writer, s string) {
+	writeUvarint(w, uint64(len(s)))
+	io.WriteString(w, s)
+}
@@ -0,0 +1,102 @@
+package gospeech
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCompiledDictionaryRoundTrip(t *testing.T) {
+	source := "read,ɹˈid,verb\nread(2),ɹˈɛd,past\nlead,lˈid,verb\nlead(2),lˈɛd,noun\n" +
+		"the,ðə\nthe(2),ðˈi\ncat,kˈæt\n"
+	// Enough words to fill several blocks, with long shared prefixes.
+	for i := 0; i < compiledBlockSize*3+5; i++ {
+		source += fmt.Sprintf("word%03d,wˈɝd%d\n", i, i%10)
+	}
+	dict, err := parseDictionary(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled := compileDictionary(t, dict)
+
+	if compiled.Len() != len(dict) {
+		t.Errorf("expected %d words but got %d", len(dict), compiled.Len())
+	}
+	for word, expected := range dict {
+		if actual := compiled.Pronunciations(word); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("word %q: expected %v but got %v", word, expected, actual)
+		}
+	}
+	for _, word := range []string{"", "a", "reads", "word", "word999", "zzz"} {
+		if prons := compiled.Pronunciations(word); prons != nil {
+			t.Errorf("unexpected pronunciations for %q: %v", word, prons)
+		}
+	}
+
+	expected := Pronunciation{IPA: "ɹˈɛd", POS: PastVerb}
+	if prons := compiled.Pronunciations("read"); len(prons) != 2 || prons[1] != expected {
+		t.Errorf("unexpected variants of \"read\": %v", prons)
+	}
+	if dict.TranslateToIPA("I read the cat") != compiled.TranslateToIPA("I read the cat") {
+		t.Error("translations differ")
+	}
+}
+
+func TestCompiledDictionaryCorrupt(t *testing.T) {
+	dict := Dictionary{}
+	for i := 0; i < compiledBlockSize*2; i++ {
+		dict[fmt.Sprintf("word%03d", i)] = []Pronunciation{{IPA: "wˈɝd"}}
+	}
+	var buf bytes.Buffer
+	if err := dict.WriteCompiled(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// Truncated or damaged data must either fail to load or fail lookups gracefully.
+	for i := len(compiledMagic); i < len(data); i++ {
+		if c, err := NewCompiledDictionary(data[:i]); err == nil {
+			lookupAll(c, dict)
+		}
+		damaged := append([]byte{}, data...)
+		damaged[i] ^= 0xff
+		if c, err := NewCompiledDictionary(damaged); err == nil {
+			lookupAll(c, dict)
+		}
+	}
+}
+
+func TestCompiledDictionaryUnsorted(t *testing.T) {
+	dict := Dictionary{}
+	for i := 0; i < compiledBlockSize*2; i++ {
+		dict[fmt.Sprintf("word%03d", i)] = []Pronunciation{{IPA: "wˈɝd"}}
+	}
+	var buf bytes.Buffer
+	if err := dict.WriteCompiled(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// The first block starts with "word000" and the second with "word032".
+	data := bytes.Replace(buf.Bytes(), []byte("word032"), []byte("word000"), 1)
+	if _, err := NewCompiledDictionary(data); err == nil {
+		t.Error("expected an error for unsorted blocks")
+	}
+}
+
+func compileDictionary(t *testing.T, d Dictionary) *CompiledDictionary {
+	var buf bytes.Buffer
+	if err := d.WriteCompiled(&buf); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCompiledDictionary(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func lookupAll(c *CompiledDictionary, d Dictionary) {
+	for word := range d {
+		c.Pronunciations(word)
+	}
+}
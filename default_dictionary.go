@@ -0,0 +1,26 @@
+package gospeech
+
+import (
+	_ "embed"
+	"sync"
+)
+
+//go:generate go run ./compile-dict dict/cmudict-IPA.txt dict/cmudict-IPA.gsd
+
+//go:embed dict/cmudict-IPA.gsd
+var defaultDictionaryData []byte
+
+var defaultDictionaryOnce sync.Once
+var defaultDictionary *CompiledDictionary
+
+// DefaultDictionary returns the CMU-based English dictionary which is embedded in this package.
+func DefaultDictionary() *CompiledDictionary {
+	defaultDictionaryOnce.Do(func() {
+		var err error
+		defaultDictionary, err = NewCompiledDictionary(defaultDictionaryData)
+		if err != nil {
+			panic("invalid embedded dictionary: " + err.Error())
+		}
+	})
+	return defaultDictionary
+}
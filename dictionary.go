@@ -7,37 +7,169 @@ import (
 	"strings"
 )
 
-// A Dictionary maps lowercase words to their IPA representations.
-type Dictionary map[string]string
+// A PartOfSpeech is a coarse grammatical category used to choose between the
+// pronunciations of a homograph.
+type PartOfSpeech string
+
+const (
+	AnyPartOfSpeech PartOfSpeech = ""
+	Noun            PartOfSpeech = "noun"
+	Verb            PartOfSpeech = "verb"
+	PastVerb        PartOfSpeech = "past"
+	Adjective       PartOfSpeech = "adj"
+)
+
+// A Pronunciation is one way of saying a word.
+type Pronunciation struct {
+	IPA string
+
+	// POS is the part of speech this pronunciation is used for, or AnyPartOfSpeech if the
+	// pronunciation is not specific to a part of speech.
+	POS PartOfSpeech
+}
+
+// A Lexicon looks up the pronunciations of lowercase words.
+type Lexicon interface {
+	// Pronunciations returns every pronunciation of a word, default first.
+	// It returns nil for unknown words.
+	Pronunciations(word string) []Pronunciation
+
+	// TranslateToIPA converts the words in a block of text into IPA.
+	TranslateToIPA(text string) string
+}
+
+// LoadLexicon reads either a compiled dictionary or a dictionary in the format expected by
+// LoadDictionary, depending on the file's contents.
+func LoadLexicon(path string) (Lexicon, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if IsCompiledDictionary(contents) {
+		c, err := NewCompiledDictionary(contents)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	d, err := parseDictionary(string(contents))
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// A Dictionary maps lowercase words to their IPA pronunciations.
+// The first pronunciation for a word is its default.
+type Dictionary map[string][]Pronunciation
 
 // LoadDictionary reads a dictionary file.
-// The file must be CSV with two columns: the word and the word's IPA representation.
+//
+// The file must be CSV with two or three columns: the word, the word's IPA representation, and
+// an optional part of speech.
+// Alternative pronunciations are listed as separate entries whose words have a numeric suffix,
+// as in "read(2)".
 func LoadDictionary(path string) (Dictionary, error) {
 	contents, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	lines := strings.Split(string(contents), "\n")
+	return parseDictionary(string(contents))
+}
+
+func parseDictionary(contents string) (Dictionary, error) {
+	lines := strings.Split(contents, "\n")
 	res := Dictionary{}
+	seen := map[string]bool{}
 	for i, line := range lines {
 		if len(line) == 0 {
 			continue
 		}
 		comps := strings.Split(line, ",")
-		if len(comps) != 2 {
+		if len(comps) != 2 && len(comps) != 3 {
 			return nil, errors.New("unexpected string at line: " + strconv.Itoa(i))
 		}
-		if _, ok := res[comps[0]]; ok {
+		if seen[comps[0]] {
 			return nil, errors.New("repeated entry: " + comps[0])
 		}
-		res[comps[0]] = comps[1]
+		seen[comps[0]] = true
+		pron := Pronunciation{IPA: comps[1]}
+		if len(comps) == 3 {
+			pron.POS = PartOfSpeech(comps[2])
+		}
+		word := stripVariantSuffix(comps[0])
+		res[word] = append(res[word], pron)
 	}
 	return res, nil
 }
 
+// Pronunciations returns every pronunciation of a word, default first.
+func (d Dictionary) Pronunciations(word string) []Pronunciation {
+	return d[word]
+}
+
 // TranslateToIPA uses the dictionary to convert the words in a block of text into IPA.
 // This will ignore punctuation, capitalization, etc.
+//
+// When a word has several pronunciations, the surrounding words are used to guess its part of
+// speech and pick the matching pronunciation.
 func (d Dictionary) TranslateToIPA(text string) string {
+	return translateToIPA(d, text)
+}
+
+func translateToIPA(l Lexicon, text string) string {
+	var res []string
+	for _, word := range TranslateWords(l, text) {
+		res = append(res, word.IPA)
+	}
+	return strings.Join(res, " ")
+}
+
+// A TranslatedWord pairs a normalized word from some text with its IPA pronunciation.
+type TranslatedWord struct {
+	Text string
+	IPA  string
+}
+
+// TranslateWords is like TranslateToIPA, but it reports which word produced each pronunciation.
+// Words which are not in the lexicon are omitted.
+func TranslateWords(l Lexicon, text string) []TranslatedWord {
+	words := normalizeWords(text)
+	res := []TranslatedWord{}
+	for i, word := range words {
+		prons := l.Pronunciations(word)
+		if len(prons) == 0 {
+			continue
+		}
+		var prev, next string
+		if i > 0 {
+			prev = words[i-1]
+		}
+		if i < len(words)-1 {
+			next = words[i+1]
+		}
+		pron := choosePronunciation(prons, guessPartOfSpeech(prev, next))
+		res = append(res, TranslatedWord{Text: word, IPA: pron.IPA})
+	}
+
+	return res
+}
+
+// UnknownWords returns the normalized words of some text which are not in the lexicon, in the
+// order they appear.
+// These are the words that TranslateToIPA and TranslateWords skip.
+func UnknownWords(l Lexicon, text string) []string {
+	var res []string
+	for _, word := range normalizeWords(text) {
+		if len(l.Pronunciations(word)) == 0 {
+			res = append(res, word)
+		}
+	}
+	return res
+}
+
+// normalizeWords splits text into lowercase words without punctuation.
+func normalizeWords(text string) []string {
 	text = strings.ToLower(text)
 	text = strings.Replace(text, "'", "", -1)
 	text = strings.Replace(text, ".", " ", -1)
@@ -45,14 +177,24 @@ func (d Dictionary) TranslateToIPA(text string) string {
 	text = strings.Replace(text, ";", " ", -1)
 	text = strings.Replace(text, "-", " ", -1)
 	text = strings.Replace(text, ",", " ", -1)
+	text = strings.Replace(text, "!", " ", -1)
+	text = strings.Replace(text, ":", " ", -1)
+	text = strings.Replace(text, "\"", " ", -1)
 	text = strings.Replace(text, "\n", " ", -1)
+	return strings.Fields(text)
+}
 
-	res := []string{}
-	for _, word := range strings.Fields(text) {
-		if ipa, ok := d[word]; ok {
-			res = append(res, ipa)
-		}
+// stripVariantSuffix turns a word like "read(2)" into "read".
+func stripVariantSuffix(word string) string {
+	if !strings.HasSuffix(word, ")") {
+		return word
 	}
-
-	return strings.Join(res, " ")
+	idx := strings.LastIndex(word, "(")
+	if idx <= 0 {
+		return word
+	}
+	if _, err := strconv.Atoi(word[idx+1 : len(word)-1]); err != nil {
+		return word
+	}
+	return word[:idx]
 }
@@ -0,0 +1,67 @@
+package gospeech
+
+// These word lists drive a deliberately simple part-of-speech guess for homographs like "read",
+// "lead", and "record".
+// The guess only looks at the words immediately before and after the homograph.
+
+var verbCueWords = wordSet("to", "will", "would", "can", "could", "shall", "should", "may",
+	"might", "must", "do", "does", "did", "dont", "doesnt", "didnt", "cant", "wont", "lets",
+	"please", "i", "you", "we", "they")
+
+var pastCueWords = wordSet("have", "has", "had", "havent", "hasnt", "hadnt", "was", "were",
+	"been", "being", "is", "are", "am", "he", "she", "it")
+
+var nounCueWords = wordSet("the", "a", "an", "this", "that", "these", "those", "my", "your",
+	"his", "her", "its", "our", "their", "some", "any", "no", "each", "every", "new", "old")
+
+// objectCueWords usually begin a noun phrase, which suggests that the word before them is a verb.
+var objectCueWords = wordSet("the", "a", "an", "this", "that", "these", "those", "my", "your",
+	"his", "her", "its", "our", "their", "me", "him", "us", "them", "it")
+
+func wordSet(words ...string) map[string]bool {
+	res := map[string]bool{}
+	for _, w := range words {
+		res[w] = true
+	}
+	return res
+}
+
+// guessPartOfSpeech guesses the role of a word from its neighbors.
+// Either neighbor may be "" if it does not exist.
+func guessPartOfSpeech(prev, next string) PartOfSpeech {
+	switch {
+	case nounCueWords[prev]:
+		return Noun
+	case verbCueWords[prev]:
+		return Verb
+	case pastCueWords[prev]:
+		return PastVerb
+	case objectCueWords[next]:
+		return Verb
+	}
+	return AnyPartOfSpeech
+}
+
+// choosePronunciation picks the pronunciation which best fits a guessed part of speech.
+// The default pronunciation is used when nothing fits.
+func choosePronunciation(prons []Pronunciation, pos PartOfSpeech) Pronunciation {
+	if len(prons) == 1 || pos == AnyPartOfSpeech {
+		return prons[0]
+	}
+	// Adjectives fill the same slots as nouns after a determiner and as past participles after a
+	// form of "be"; many past participles are spelled like the present tense.
+	preferences := map[PartOfSpeech][]PartOfSpeech{
+		Noun:      {Noun, Adjective},
+		Verb:      {Verb},
+		PastVerb:  {PastVerb, Adjective, Verb},
+		Adjective: {Adjective, Noun},
+	}
+	for _, want := range preferences[pos] {
+		for _, p := range prons {
+			if p.POS == want {
+				return p
+			}
+		}
+	}
+	return prons[0]
+}
@@ -39,9 +39,9 @@ func (v Vowel) EncodeBeginning(system VocalSystem, lastPhone, nextPhone Phone) {
 		system.AdjustFormants(startFormants, v.Duration/6)
 		system.AdjustFormants(v.Formants, v.Duration/2)
 	}
-	system.Turbulence().AdjustVolume(0, v.Duration/4)
-	system.ConsonantVoice().AdjustVolume(0, v.Duration/3)
-	system.Liquid().AdjustVolume(0, v.Duration/3)
+	system.Turbulence().AdjustVolumeCurve(0, v.Duration/4, tracks.Cosine)
+	system.ConsonantVoice().AdjustVolumeCurve(0, v.Duration/3, tracks.Cosine)
+	system.Liquid().AdjustVolumeCurve(0, v.Duration/3, tracks.Cosine)
 	system.FormantsTrack().Continue(v.Duration / 3)
 	system.EvenOut()
 }
@@ -64,15 +64,15 @@ func (b BilabialPlosive) EncodeBeginning(system VocalSystem, lastPhone, nextPhon
 		endFormant := b.previousFormantPull(system.Formants())
 		system.AdjustFormants(endFormant, time.Millisecond*30)
 	}
-	system.Turbulence().AdjustVolume(0, time.Millisecond*30)
-	system.ConsonantVoice().AdjustVolume(0, time.Millisecond*30)
-	system.Liquid().AdjustVolume(0, time.Millisecond*30)
+	system.Turbulence().AdjustVolumeCurve(0, time.Millisecond*30, tracks.Cosine)
+	system.ConsonantVoice().AdjustVolumeCurve(0, time.Millisecond*30, tracks.Cosine)
+	system.Liquid().AdjustVolumeCurve(0, time.Millisecond*30, tracks.Cosine)
 	system.Continue(time.Millisecond * 50)
 	if b.Voiced {
-		system.ConsonantVoice().AdjustVolume(0.1, time.Millisecond*10)
+		system.ConsonantVoice().AdjustVolumeCurve(0.1, time.Millisecond*10, tracks.Cosine)
 	}
 	turbulence := system.Turbulence()[tracks.TrackID("P")]
-	turbulence.AdjustVolume(0.3, time.Millisecond*3)
+	turbulence.AdjustVolumeCurve(0.3, time.Millisecond*3, tracks.Cosine)
 	turbulence.Continue(time.Millisecond * 30)
 	system.EvenOut()
 }
@@ -110,23 +110,23 @@ func (a AlveolarPlosive) EncodeBeginning(system VocalSystem, lastPhone, nextPhon
 	if system.FormantsTrack().Volume() > 0 {
 		system.AdjustFormants(a.FormantPull(system.Formants()), time.Millisecond*50)
 	}
-	system.Turbulence().AdjustVolume(0, time.Millisecond*50)
-	system.ConsonantVoice().AdjustVolume(0, time.Millisecond*50)
-	system.Liquid().AdjustVolume(0, time.Millisecond*50)
+	system.Turbulence().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
+	system.ConsonantVoice().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
+	system.Liquid().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
 
 	system.Continue(time.Millisecond * 10)
 	if a.Voiced {
-		system.ConsonantVoice().AdjustVolume(0.3, time.Millisecond*50)
+		system.ConsonantVoice().AdjustVolumeCurve(0.3, time.Millisecond*50, tracks.Cosine)
 		if !a.ContinueToNext {
-			system.ConsonantVoice().AdjustVolume(0, time.Millisecond*50)
+			system.ConsonantVoice().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
 		}
 	}
 	turbulence := system.Turbulence()[tracks.TrackID("S")]
 	turbulence.Continue(time.Millisecond * 20)
-	turbulence.AdjustVolume(0.3, time.Millisecond*3)
+	turbulence.AdjustVolumeCurve(0.3, time.Millisecond*3, tracks.Cosine)
 	turbulence.Continue(time.Millisecond * 20)
 	if !a.ContinueToNext {
-		turbulence.AdjustVolume(0, time.Millisecond*20)
+		turbulence.AdjustVolumeCurve(0, time.Millisecond*20, tracks.Cosine)
 	}
 	system.EvenOut()
 }
@@ -150,18 +150,18 @@ func (v VelarPlosive) EncodeBeginning(system VocalSystem, lastPhone, nextPhone P
 	if system.FormantsTrack().Volume() > 0 {
 		system.AdjustFormants(v.FormantPull(system.Formants()), time.Millisecond*50)
 	}
-	system.Turbulence().AdjustVolume(0, time.Millisecond*50)
-	system.ConsonantVoice().AdjustVolume(0, time.Millisecond*50)
-	system.Liquid().AdjustVolume(0, time.Millisecond*50)
+	system.Turbulence().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
+	system.ConsonantVoice().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
+	system.Liquid().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
 
 	if v.Voiced {
-		system.ConsonantVoice().AdjustVolume(0.1, time.Millisecond*20)
+		system.ConsonantVoice().AdjustVolumeCurve(0.1, time.Millisecond*20, tracks.Cosine)
 	}
 	turbulence := system.Turbulence()[tracks.TrackID("K")]
 	turbulence.Continue(time.Millisecond * 20)
-	turbulence.AdjustVolume(0.2, time.Millisecond*5)
+	turbulence.AdjustVolumeCurve(0.2, time.Millisecond*5, tracks.Cosine)
 	turbulence.Continue(time.Millisecond * 20)
-	turbulence.AdjustVolume(0, time.Millisecond*10)
+	turbulence.AdjustVolumeCurve(0, time.Millisecond*10, tracks.Cosine)
 	system.EvenOut()
 }
 
@@ -188,9 +188,9 @@ func (n Nasal) EncodeBeginning(system VocalSystem, lastPhone, nextPhone Phone) {
 	if system.FormantsTrack().Volume() > 0 {
 		system.AdjustFormants(n.FormantPull(system.Formants()), time.Millisecond*50)
 	}
-	system.Turbulence().AdjustVolume(0, time.Millisecond*50)
-	system.ConsonantVoice().AdjustVolume(0, time.Millisecond*50)
-	system.Liquid().AdjustVolume(0, time.Millisecond*50)
+	system.Turbulence().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
+	system.ConsonantVoice().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
+	system.Liquid().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
 
 	system.AdjustFormants(n.Formants, time.Millisecond*50)
 	system.EvenOut()
@@ -231,17 +231,18 @@ func (f Fricative) EncodeBeginning(system VocalSystem, lastPhone, nextPhone Phon
 	if system.FormantsTrack().Volume() > 0 {
 		system.AdjustFormants(f.FormantPull(system.Formants()), time.Millisecond*50)
 	}
-	system.Turbulence().ExcludeTracks(tracks.TrackID(f.Type)).AdjustVolume(0, time.Millisecond*50)
-	system.Liquid().AdjustVolume(0, time.Millisecond*50)
+	system.Turbulence().ExcludeTracks(tracks.TrackID(f.Type)).AdjustVolumeCurve(0,
+		time.Millisecond*50, tracks.Cosine)
+	system.Liquid().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
 
 	if f.Voiced {
-		system.ConsonantVoice().AdjustVolume(0.3, time.Millisecond*100)
+		system.ConsonantVoice().AdjustVolumeCurve(0.3, time.Millisecond*100, tracks.Cosine)
 	} else {
-		system.ConsonantVoice().AdjustVolume(0, time.Millisecond*50)
+		system.ConsonantVoice().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
 	}
 
 	turbulence := system.Turbulence()[tracks.TrackID(f.Type)]
-	turbulence.AdjustVolume(0.3, time.Millisecond*100)
+	turbulence.AdjustVolumeCurve(0.3, time.Millisecond*100, tracks.Cosine)
 	system.EvenOut()
 }
 
@@ -279,9 +280,9 @@ func (l LateralLiquid) EncodeBeginning(system VocalSystem, lastPhone, nextPhone
 	if system.FormantsTrack().Volume() > 0 {
 		system.AdjustFormants(l.FormantPull(system.Formants()), time.Millisecond*50)
 	}
-	system.Turbulence().AdjustVolume(0, time.Millisecond*50)
-	system.ConsonantVoice().AdjustVolume(0, time.Millisecond*50)
-	system.Liquid().AdjustVolume(0.3, time.Millisecond*50)
+	system.Turbulence().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
+	system.ConsonantVoice().AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
+	system.Liquid().AdjustVolumeCurve(0.3, time.Millisecond*50, tracks.Cosine)
 	system.EvenOut()
 }
 
@@ -302,7 +303,7 @@ func (v LateralLiquid) TransitionTime() time.Duration {
 type GlottalStop struct{}
 
 func (g GlottalStop) EncodeBeginning(system VocalSystem, lastPhone, nextPhone Phone) {
-	system.AdjustVolume(0, time.Millisecond*50)
+	system.AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
 	system.Continue(time.Millisecond * 50)
 }
 
@@ -314,3 +315,31 @@ func (g GlottalStop) FormantPull(end FormantState) FormantState {
 func (v GlottalStop) TransitionTime() time.Duration {
 	return time.Millisecond * 30
 }
+
+// PhoneType returns the name of a phone's type, such as "vowel" or "fricative".
+// These are the same names that voice files use.
+// Phones of other types are described as "other".
+func PhoneType(p Phone) string {
+	switch p.(type) {
+	case Vowel:
+		return "vowel"
+	case BilabialPlosive:
+		return "bilabial_plosive"
+	case AlveolarPlosive:
+		return "alveolar_plosive"
+	case VelarPlosive:
+		return "velar_plosive"
+	case Nasal:
+		return "nasal"
+	case Fricative:
+		return "fricative"
+	case RetroflexLiquid:
+		return "retroflex_liquid"
+	case LateralLiquid:
+		return "lateral_liquid"
+	case GlottalStop:
+		return "glottal_stop"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/unixpickle/gospeech"
+	"github.com/unixpickle/gospeech/audio"
+)
+
+// A batchRow is one utterance from a batch manifest.
+//
+// Exactly one of Text and IPA must be set.
+// The voice and parameters are optional, and default to the values of the command-line flags.
+type batchRow struct {
+	ID         string   `json:"id"`
+	Text       string   `json:"text"`
+	IPA        string   `json:"ipa"`
+	Voice      string   `json:"voice"`
+	Rate       *float64 `json:"rate"`
+	Pitch      *float64 `json:"pitch"`
+	SampleRate int      `json:"sample_rate"`
+
+	// Line is the line of the manifest that the row came from.
+	Line int `json:"-"`
+}
+
+// A batchResult records what happened to one row.
+type batchResult struct {
+	Row          *batchRow
+	Err          error
+	UnknownWords []string
+}
+
+// A batchConfig holds the settings shared by every row of a batch.
+type batchConfig struct {
+	OutputDir string
+	Format    audio.Format
+	Voice     string
+	Params    gospeech.SynthesisParams
+	Dict      gospeech.Lexicon
+	Workers   int
+	Quiet     bool
+}
+
+// runBatch synthesizes every row of a manifest into its own file and prints a summary.
+// It returns false if any row failed.
+func runBatch(manifestPath string, config *batchConfig) (bool, error) {
+	rows, err := readManifest(manifestPath)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+		return false, err
+	}
+
+	rowChan := make(chan *batchRow)
+	resChan := make(chan *batchResult)
+	var wg sync.WaitGroup
+	for i := 0; i < config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range rowChan {
+				resChan <- config.synthesize(row)
+			}
+		}()
+	}
+	go func() {
+		for _, row := range rows {
+			rowChan <- row
+		}
+		close(rowChan)
+		wg.Wait()
+		close(resChan)
+	}()
+
+	var failures []*batchResult
+	unknownCounts := map[string]int{}
+	var done int
+	for res := range resChan {
+		done++
+		if res.Err != nil {
+			failures = append(failures, res)
+		}
+		for _, word := range res.UnknownWords {
+			unknownCounts[word]++
+		}
+		if !config.Quiet {
+			fmt.Fprintf(os.Stderr, "\r%d/%d", done, len(rows))
+		}
+	}
+	if !config.Quiet {
+		fmt.Fprintln(os.Stderr)
+	}
+
+	printSummary(len(rows), failures, unknownCounts)
+	return len(failures) == 0, nil
+}
+
+func (b *batchConfig) synthesize(row *batchRow) *batchResult {
+	res := &batchResult{Row: row}
+
+	voiceName := b.Voice
+	if row.Voice != "" {
+		voiceName = row.Voice
+	}
+	voice, ok := gospeech.Voices[voiceName]
+	if !ok {
+		res.Err = errors.New("unknown voice: " + voiceName)
+		return res
+	}
+
+	// The rows are already synthesized in parallel, so each one encodes its tracks one at a time.
+	params := b.Params
+	params.EncodeWorkers = 1
+	if row.Rate != nil {
+		params.Rate = *row.Rate
+	}
+	if row.Pitch != nil {
+		params.Pitch = *row.Pitch
+	}
+	if row.SampleRate != 0 {
+		params.SampleRate = row.SampleRate
+	}
+	if params.Rate <= 0 || params.Pitch <= 0 || params.SampleRate <= 0 {
+		res.Err = errors.New("rate, pitch, and sample_rate must be positive")
+		return res
+	} else if params.SampleRate > gospeech.MaxSampleRate {
+		res.Err = fmt.Errorf("sample_rate must be at most %d", gospeech.MaxSampleRate)
+		return res
+	}
+
+	ipa := row.IPA
+	if row.Text != "" {
+		ipa = b.Dict.TranslateToIPA(row.Text)
+		res.UnknownWords = gospeech.UnknownWords(b.Dict, row.Text)
+	}
+
+	var encoded bytes.Buffer
+	samples := voice.Render(ipa, params)
+	if err := audio.Encode(&encoded, b.Format, samples, params.SampleRate); err != nil {
+		res.Err = err
+		return res
+	}
+	path := filepath.Join(b.OutputDir, row.ID+b.Format.Extension())
+	res.Err = ioutil.WriteFile(path, encoded.Bytes(), 0644)
+	return res
+}
+
+func printSummary(total int, failures []*batchResult, unknownCounts map[string]int) {
+	fmt.Fprintf(os.Stderr, "Synthesized %d of %d rows.\n", total-len(failures), total)
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool {
+			return failures[i].Row.Line < failures[j].Row.Line
+		})
+		fmt.Fprintln(os.Stderr, "Failures:")
+		for _, res := range failures {
+			fmt.Fprintf(os.Stderr, "  %s (line %d): %s\n", res.Row.ID, res.Row.Line, res.Err)
+		}
+	}
+	if len(unknownCounts) > 0 {
+		var words []string
+		for word := range unknownCounts {
+			words = append(words, word)
+		}
+		sort.Slice(words, func(i, j int) bool {
+			if unknownCounts[words[i]] != unknownCounts[words[j]] {
+				return unknownCounts[words[i]] > unknownCounts[words[j]]
+			}
+			return words[i] < words[j]
+		})
+		fmt.Fprintln(os.Stderr, "Unknown words (skipped):")
+		for _, word := range words {
+			fmt.Fprintf(os.Stderr, "  %s (%d)\n", word, unknownCounts[word])
+		}
+	}
+}
+
+// readManifest reads a batch manifest.
+//
+// Manifests ending in .jsonl have one JSON object per line.
+// Other manifests are CSV files whose first row names the columns, which may be any of id, text,
+// ipa, voice, rate, pitch, and sample_rate.
+func readManifest(path string) ([]*batchRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows []*batchRow
+	if strings.HasSuffix(path, ".jsonl") {
+		rows, err = readJSONLManifest(f)
+	} else {
+		rows, err = readCSVManifest(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read manifest %s: %s", path, err)
+	}
+
+	seen := map[string]bool{}
+	for _, row := range rows {
+		if row.ID == "" || row.ID != filepath.Base(row.ID) || strings.HasPrefix(row.ID, ".") {
+			return nil, fmt.Errorf("line %d: invalid id: %q", row.Line, row.ID)
+		} else if seen[row.ID] {
+			return nil, fmt.Errorf("line %d: repeated id: %s", row.Line, row.ID)
+		} else if (row.Text == "") == (row.IPA == "") {
+			return nil, fmt.Errorf("line %d: exactly one of text and ipa must be provided",
+				row.Line)
+		}
+		seen[row.ID] = true
+	}
+	return rows, nil
+}
+
+func readJSONLManifest(r io.Reader) ([]*batchRow, error) {
+	var rows []*batchRow
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		row := &batchRow{Line: line}
+		decoder := json.NewDecoder(strings.NewReader(scanner.Text()))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(row); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+func readCSVManifest(r io.Reader) ([]*batchRow, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	for _, column := range header {
+		switch column {
+		case "id", "text", "ipa", "voice", "rate", "pitch", "sample_rate":
+		default:
+			return nil, errors.New("unknown column: " + column)
+		}
+	}
+
+	var rows []*batchRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		row := &batchRow{Line: line}
+		for i, value := range record {
+			if value == "" {
+				continue
+			}
+			switch header[i] {
+			case "id":
+				row.ID = value
+			case "text":
+				row.Text = value
+			case "ipa":
+				row.IPA = value
+			case "voice":
+				row.Voice = value
+			case "rate":
+				row.Rate, err = parseFloatField(value)
+			case "pitch":
+				row.Pitch, err = parseFloatField(value)
+			case "sample_rate":
+				row.SampleRate, err = strconv.Atoi(value)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid %s: %s", line, header[i], value)
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func parseFloatField(value string) (*float64, error) {
+	x, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &x, nil
+}
@@ -1,49 +1,267 @@
+// Command say-file synthesizes speech from text or phonetics and saves it as an audio file.
+//
+// Input comes from the files given with -i, or from standard input.
+// Output goes to the file given with -o, or to standard output if that path is "-".
+// The input is synthesized a line at a time, and the audio is written as soon as it is ready,
+// so that it can be piped into a player such as aplay:
+//
+//	say-file -q -o - -format pcm -sample-rate 22050 <book.txt | aplay -f S16_LE -r 22050
+//
+// With -batch, a manifest of many utterances is synthesized in parallel instead, with one file
+// per utterance in the -outdir directory.
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/unixpickle/gospeech"
-	"github.com/unixpickle/wav"
+	"github.com/unixpickle/gospeech/audio"
 )
 
+// A fileList is a flag which may be passed more than once.
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(path string) error {
+	*f = append(*f, path)
+	return nil
+}
+
 func main() {
-	var rawPhonetics bool
-	if len(os.Args) == 2 {
-		if os.Args[1] == "-phonetics" {
-			rawPhonetics = true
+	var inputPaths fileList
+	var outputPath, voiceName, dictPath, formatName, batchPath, outputDir string
+	var rawPhonetics, xsampa, quiet bool
+	var workers int
+	params := gospeech.DefaultSynthesisParams
+	flag.Var(&inputPaths, "i", "input file (may be repeated; defaults to standard input)")
+	flag.StringVar(&outputPath, "o", "output.wav", "output file, or - for standard output")
+	flag.StringVar(&voiceName, "voice", "default", "name of the voice")
+	flag.StringVar(&dictPath, "dict", "", "dictionary file (defaults to the built-in dictionary)")
+	flag.Float64Var(&params.Rate, "rate", params.Rate, "speaking rate (2 is twice as fast)")
+	flag.Float64Var(&params.Pitch, "pitch", params.Pitch, "pitch (2 is an octave higher; formants shift too)")
+	flag.IntVar(&params.SampleRate, "sample-rate", params.SampleRate, "samples per second")
+	flag.StringVar(&formatName, "format", "", "audio format: "+formatNames()+
+		" (defaults to the output file's extension, or wav)")
+	flag.BoolVar(&rawPhonetics, "phonetics", false, "read IPA instead of English")
+	flag.BoolVar(&xsampa, "xsampa", false, "read X-SAMPA instead of English")
+	flag.BoolVar(&quiet, "q", false, "do not print prompts or status messages")
+	flag.StringVar(&batchPath, "batch", "", "manifest of utterances to synthesize (CSV or .jsonl)")
+	flag.StringVar(&outputDir, "outdir", ".", "output directory for -batch")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "number of parallel syntheses for -batch")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: say-file [flags]")
+		fmt.Fprintln(os.Stderr, "       say-file -batch <manifest> [flags]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if rawPhonetics && xsampa {
+		die("-phonetics and -xsampa cannot be used together")
+	}
+	if params.Rate <= 0 || params.Pitch <= 0 {
+		die("-rate and -pitch must be positive")
+	}
+	if params.SampleRate <= 0 || params.SampleRate > gospeech.MaxSampleRate {
+		die("-sample-rate must be positive and at most", gospeech.MaxSampleRate)
+	}
+	if workers < 1 {
+		die("-workers must be positive")
+	}
+	voice, ok := gospeech.Voices[voiceName]
+	if !ok {
+		die("unknown voice:", voiceName)
+	}
+	format, err := outputFormat(formatName, outputPath)
+	if err != nil {
+		die(err)
+	}
+
+	if batchPath != "" {
+		if rawPhonetics || xsampa {
+			die("-phonetics and -xsampa cannot be used with -batch; use the ipa column instead")
+		}
+		ok, err := runBatch(batchPath, &batchConfig{
+			OutputDir: outputDir,
+			Format:    format,
+			Voice:     voiceName,
+			Params:    params,
+			Dict:      loadDictionary(dictPath),
+			Workers:   workers,
+			Quiet:     quiet,
+		})
+		if err != nil {
+			die(err)
+		} else if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(inputPaths) == 0 && !quiet {
+		if rawPhonetics {
+			fmt.Fprintln(os.Stderr, "Please enter some IPA text:")
+		} else if xsampa {
+			fmt.Fprintln(os.Stderr, "Please enter some X-SAMPA text:")
 		} else {
-			fmt.Fprintln(os.Stderr, "Usage: say-file [-phonetics]")
+			fmt.Fprintln(os.Stderr, "Please enter some English text:")
 		}
 	}
+	input, closeInput, err := openInput(inputPaths)
+	if err != nil {
+		die(err)
+	}
+	defer closeInput()
 
-	if rawPhonetics {
-		fmt.Println("Please enter some IPA text:")
-	} else {
-		fmt.Println("Please enter some English text:")
+	var dict gospeech.Lexicon
+	if !rawPhonetics && !xsampa {
+		dict = loadDictionary(dictPath)
+	}
+	phrases := func(line string) ([]string, error) {
+		if rawPhonetics {
+			return []string{line}, nil
+		} else if xsampa {
+			ipa, err := gospeech.XSAMPAToIPA(line)
+			return []string{ipa}, err
+		}
+		var res []string
+		for _, sentence := range gospeech.SplitSentences(line) {
+			res = append(res, dict.TranslateToIPA(sentence))
+		}
+		return res, nil
 	}
 
-	input, err := ioutil.ReadAll(os.Stdin)
+	output := os.Stdout
+	if outputPath != "-" {
+		output, err = os.Create(outputPath)
+		if err != nil {
+			die(err)
+		}
+	}
+	stream, err := audio.NewStreamWriter(output, format, params.SampleRate)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		die(err)
 	}
+	if err := speakLines(input, stream, voice, params, phrases); err != nil {
+		die(err)
+	}
+	if err := stream.Close(); err != nil {
+		die(err)
+	}
+	if err := output.Close(); err != nil {
+		die(err)
+	}
+	if !quiet && outputPath != "-" {
+		fmt.Fprintln(os.Stderr, "Saved", outputPath)
+	}
+}
 
-	var phonetics string
-	if rawPhonetics {
-		phonetics = string(input)
-	} else {
-		dict, err := gospeech.LoadDictionary("../dict/cmudict-IPA.txt")
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+// speakLines synthesizes the input one line at a time, so that the start of the audio is written
+// before the rest of the input has been read or synthesized.
+// The phrases function converts a line into IPA phrases.
+func speakLines(input io.Reader, stream audio.StreamWriter, voice gospeech.Voice,
+	params gospeech.SynthesisParams, phrases func(line string) ([]string, error)) error {
+	reader := bufio.NewReader(input)
+	for {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			ipaPhrases, err := phrases(line)
+			if err != nil {
+				return err
+			}
+			for _, ipa := range ipaPhrases {
+				if err := stream.WriteSamples(voice.Render(ipa, params)); err != nil {
+					return err
+				}
+			}
 		}
-		phonetics = dict.TranslateToIPA(string(input))
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+// loadDictionary loads a dictionary file, or the built-in dictionary if the path is empty.
+func loadDictionary(path string) gospeech.Lexicon {
+	if path == "" {
+		return gospeech.DefaultDictionary()
 	}
+	dict, err := gospeech.LoadLexicon(path)
+	if err != nil {
+		die(err)
+	}
+	return dict
+}
+
+// openInput opens the input files one after another, or standard input if there are none.
+func openInput(paths []string) (io.Reader, func(), error) {
+	if len(paths) == 0 {
+		return os.Stdin, func() {}, nil
+	}
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	var readers []io.Reader
+	for _, path := range paths {
+		if path == "-" {
+			readers = append(readers, os.Stdin)
+		} else {
+			f, err := os.Open(path)
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+			files = append(files, f)
+			readers = append(readers, f)
+		}
+		// Separate the files in case one does not end with a line break.
+		readers = append(readers, strings.NewReader("\n"))
+	}
+	return io.MultiReader(readers...), closeAll, nil
+}
+
+// outputFormat picks the audio format from the -format flag or the output file's extension.
+func outputFormat(name, outputPath string) (audio.Format, error) {
+	if name != "" {
+		return audio.ParseFormat(name)
+	}
+	ext := filepath.Ext(outputPath)
+	for _, format := range audio.Formats {
+		if outputPath != "-" && format.Extension() == ext {
+			return format, nil
+		}
+	}
+	return audio.WAV, nil
+}
+
+func formatNames() string {
+	var names []string
+	for _, format := range audio.Formats {
+		names = append(names, string(format))
+	}
+	return strings.Join(names, ", ")
+}
 
-	synthesized := gospeech.DefaultVoice.Synthesize(phonetics)
-	wav.WriteFile(synthesized, "output.wav")
-	fmt.Println("Saved output.wav")
+func die(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,307 @@
+// Command sd_gospeech is a speech-dispatcher output module backed by gospeech.
+//
+// The module speaks speech-dispatcher's output module protocol on standard input and output.
+// Since standard output carries the protocol, audio goes either to a player command, such as
+// aplay, or to a file of raw signed 16-bit little-endian PCM.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/unixpickle/gospeech"
+	"github.com/unixpickle/gospeech/audio"
+)
+
+const defaultPlayer = "aplay -q -t raw -f S16_LE -c 1 -r {rate}"
+
+var ssmlTag = regexp.MustCompile(`<[^>]*>`)
+
+func main() {
+	var outputPath, player, dictPath string
+	var sampleRate int
+	flag.StringVar(&outputPath, "output", "", "write raw PCM to this file instead of playing it")
+	flag.StringVar(&player, "player", defaultPlayer, "command which plays raw PCM from stdin")
+	flag.StringVar(&dictPath, "dict", "", "dictionary file (defaults to the built-in dictionary)")
+	flag.IntVar(&sampleRate, "sample-rate", 22050, "sample rate of the synthesized audio")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sd_gospeech [flags] [config_file]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// speech-dispatcher passes the path of a module configuration file, which is not needed.
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if outputPath == "" && strings.TrimSpace(player) == "" {
+		fmt.Fprintln(os.Stderr, "The player command must not be empty.")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if sampleRate <= 0 {
+		fmt.Fprintln(os.Stderr, "The sample rate must be positive.")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var sink Sink = &CommandSink{Command: player}
+	if outputPath != "" {
+		var err error
+		sink, err = NewFileSink(outputPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	var dict gospeech.Lexicon = gospeech.DefaultDictionary()
+	if dictPath != "" {
+		var err error
+		dict, err = gospeech.LoadLexicon(dictPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	module := &Module{
+		Dictionary: dict,
+		Sink:       sink,
+		SampleRate: sampleRate,
+		Settings:   map[string]string{},
+		output:     os.Stdout,
+	}
+	if err := module.Run(os.Stdin); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// A Module implements the output module protocol.
+type Module struct {
+	Dictionary gospeech.Lexicon
+	Sink       Sink
+	SampleRate int
+
+	// Settings holds the most recent value of every setting from SET commands.
+	Settings map[string]string
+
+	output     io.Writer
+	outputLock sync.Mutex
+
+	cancelSpeech context.CancelFunc
+	speechDone   chan struct{}
+}
+
+// Run handles commands until the input ends or QUIT is received.
+func (m *Module) Run(input io.Reader) error {
+	reader := bufio.NewReader(input)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			m.stop()
+			return nil
+		} else if err != nil {
+			return err
+		}
+		command := strings.TrimRight(line, "\r\n")
+
+		switch command {
+		case "INIT":
+			m.reply("299-gospeech initialized", "299 OK LOADED SUCCESSFULLY")
+		case "AUDIO":
+			m.reply("207 OK RECEIVING AUDIO SETTINGS")
+			if _, err := readBlock(reader); err != nil {
+				return err
+			}
+			m.reply("203 OK AUDIO INITIALIZED")
+		case "LOGLEVEL":
+			m.reply("207 OK RECEIVING LOGLEVEL SETTINGS")
+			if _, err := readBlock(reader); err != nil {
+				return err
+			}
+			m.reply("203 OK LOG LEVEL SET")
+		case "SET":
+			m.reply("203 OK RECEIVING SETTINGS")
+			lines, err := readBlock(reader)
+			if err != nil {
+				return err
+			}
+			for _, line := range lines {
+				if idx := strings.Index(line, "="); idx >= 0 {
+					m.Settings[line[:idx]] = line[idx+1:]
+				}
+			}
+			m.reply("203 OK SETTINGS RECEIVED")
+		case "SPEAK", "CHAR", "KEY", "SOUND_ICON":
+			m.reply("202 OK RECEIVING MESSAGE")
+			lines, err := readBlock(reader)
+			if err != nil {
+				return err
+			}
+			text := strings.Join(lines, "\n")
+			switch command {
+			case "SPEAK":
+				text = html.UnescapeString(ssmlTag.ReplaceAllString(text, " "))
+			case "KEY":
+				text = strings.Replace(text, "_", " ", -1)
+			case "SOUND_ICON":
+				text = ""
+			}
+			m.reply("200 OK SPEAKING")
+			m.speak(text)
+		case "STOP", "PAUSE":
+			m.stop()
+		case "LIST VOICES":
+			m.reply(voiceList()...)
+		case "QUIT":
+			m.stop()
+			m.reply("210 OK QUIT")
+			return nil
+		default:
+			m.reply("300 ERR UNKNOWN COMMAND")
+		}
+	}
+}
+
+// speak synthesizes and plays text in the background, reporting events as it goes.
+// Any ongoing speech is stopped first.
+func (m *Module) speak(text string) {
+	m.stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	m.cancelSpeech = cancel
+	m.speechDone = done
+
+	voice, params := m.voiceAndParams()
+	go func() {
+		defer close(done)
+		m.reply("701 BEGIN")
+		err := m.play(ctx, voice, params, text)
+		if ctx.Err() != nil {
+			m.reply("703 STOPPED")
+		} else {
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "playback failed:", err)
+			}
+			m.reply("702 END")
+		}
+	}()
+}
+
+func (m *Module) play(ctx context.Context, voice gospeech.Voice,
+	params gospeech.SynthesisParams, text string) error {
+	writer, err := m.Sink.Start(ctx, params.SampleRate)
+	if err != nil {
+		return err
+	}
+	for _, sentence := range gospeech.SplitSentences(text) {
+		// Rendering stops as soon as speech is stopped, even in the middle of a sentence.
+		samples, err := voice.RenderContext(ctx, m.Dictionary.TranslateToIPA(sentence), params)
+		if err != nil {
+			break
+		}
+		if err := audio.Encode(writer, audio.PCM, samples, params.SampleRate); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// stop interrupts any ongoing speech and waits for it to end.
+func (m *Module) stop() {
+	if m.cancelSpeech != nil {
+		m.cancelSpeech()
+		<-m.speechDone
+		m.cancelSpeech = nil
+	}
+}
+
+// voiceAndParams converts the current settings into a voice and synthesis parameters.
+//
+// The rate, pitch, and volume settings range from -100 to 100.
+// Rate and pitch are mapped exponentially, so that 100 is four times (rate) or twice (pitch) the
+// normal value, and -100 is the reciprocal of that.
+func (m *Module) voiceAndParams() (gospeech.Voice, gospeech.SynthesisParams) {
+	voice := gospeech.DefaultVoice
+	if v, ok := gospeech.Voices[m.Settings["synthesis_voice"]]; ok {
+		voice = v
+	}
+	params := gospeech.DefaultSynthesisParams
+	params.SampleRate = m.SampleRate
+	if rate, ok := m.setting("rate"); ok {
+		params.Rate = math.Pow(2, rate/50)
+	}
+	if pitch, ok := m.setting("pitch"); ok {
+		params.Pitch = math.Pow(2, pitch/100)
+	}
+	if volume, ok := m.setting("volume"); ok {
+		params.Volume = (volume + 100) / 200
+	}
+	return voice, params
+}
+
+// setting parses a numerical setting, clamped to the range [-100, 100].
+func (m *Module) setting(name string) (float64, bool) {
+	value, err := strconv.ParseFloat(m.Settings[name], 64)
+	if err != nil {
+		return 0, false
+	}
+	return math.Max(-100, math.Min(100, value)), true
+}
+
+func (m *Module) reply(lines ...string) {
+	m.outputLock.Lock()
+	defer m.outputLock.Unlock()
+	for _, line := range lines {
+		fmt.Fprintln(m.output, line)
+	}
+}
+
+// readBlock reads lines until a line containing a single ".".
+// Lines starting with ".." have their first dot removed, per the protocol's escaping rules.
+func readBlock(r *bufio.Reader) ([]string, error) {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "." {
+			return lines, nil
+		}
+		if strings.HasPrefix(line, "..") {
+			line = line[1:]
+		}
+		lines = append(lines, line)
+	}
+}
+
+func voiceList() []string {
+	var names []string
+	for name := range gospeech.Voices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var res []string
+	for _, name := range names {
+		res = append(res, "200-"+name+"\ten\tnone")
+	}
+	return append(res, "200 OK VOICE LIST SENT")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Sink is a destination for synthesized audio.
+type Sink interface {
+	// Start prepares to receive one utterance of raw signed 16-bit little-endian mono PCM.
+	// Playback should be abandoned if ctx is cancelled.
+	// Closing the result waits for playback to finish.
+	Start(ctx context.Context, sampleRate int) (io.WriteCloser, error)
+}
+
+// A FileSink appends the PCM of every utterance to a file, which makes it possible to test the
+// module without a sound card.
+type FileSink struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+// NewFileSink creates or truncates a file for a FileSink.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: f}, nil
+}
+
+func (f *FileSink) Start(ctx context.Context, sampleRate int) (io.WriteCloser, error) {
+	f.lock.Lock()
+	return &fileSinkWriter{sink: f}, nil
+}
+
+type fileSinkWriter struct {
+	sink *FileSink
+}
+
+func (f *fileSinkWriter) Write(data []byte) (int, error) {
+	return f.sink.file.Write(data)
+}
+
+func (f *fileSinkWriter) Close() error {
+	f.sink.lock.Unlock()
+	return nil
+}
+
+// A CommandSink pipes the PCM of every utterance into a new instance of an audio player, such as
+// "aplay -q -t raw -f S16_LE -c 1 -r {rate}".
+// The string "{rate}" in the command is replaced with the sample rate.
+type CommandSink struct {
+	Command string
+}
+
+func (c *CommandSink) Start(ctx context.Context, sampleRate int) (io.WriteCloser, error) {
+	args := strings.Fields(strings.Replace(c.Command, "{rate}", strconv.Itoa(sampleRate), -1))
+	if len(args) == 0 {
+		return nil, errors.New("empty player command")
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandSinkWriter{WriteCloser: stdin, cmd: cmd}, nil
+}
+
+type commandSinkWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (c *commandSinkWriter) Close() error {
+	c.WriteCloser.Close()
+	return c.cmd.Wait()
+}
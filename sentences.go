@@ -0,0 +1,42 @@
+package gospeech
+
+import "strings"
+
+// SplitSentences splits a block of text into sentences, so that long passages can be
+// synthesized and played back incrementally.
+//
+// Sentences end at ".", "!", "?", ";", or a line break, and the terminating punctuation is kept
+// with its sentence.
+// Blank sentences are dropped.
+func SplitSentences(text string) []string {
+	var res []string
+	var current strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			res = append(res, s)
+		}
+		current.Reset()
+	}
+	runes := []rune(text)
+	for i, r := range runes {
+		switch r {
+		case '\n':
+			flush()
+		case '.', '!', '?', ';':
+			current.WriteRune(r)
+			// Keep decimals like "3.5" and runs like "?!" together.
+			if i+1 < len(runes) && !isSentenceBreak(runes[i+1]) {
+				continue
+			}
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return res
+}
+
+func isSentenceBreak(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
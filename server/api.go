@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/unixpickle/gospeech"
+	"github.com/unixpickle/gospeech/audio"
+)
+
+const (
+	minRate       = 0.25
+	maxRate       = 4.0
+	minPitch      = 0.25
+	maxPitch      = 4.0
+	maxVolume     = 4.0
+	minSampleRate = 8000
+)
+
+// A SynthesizeRequest is the body of a request to the JSON synthesis API.
+// Exactly one of Text and IPA must be set; every other field is optional.
+//
+// Pitch scales the formants along with the pitch, as described for gospeech.SynthesisParams,
+// so it changes the timbre of the voice too.
+type SynthesizeRequest struct {
+	Text       string   `json:"text"`
+	IPA        string   `json:"ipa"`
+	Voice      string   `json:"voice"`
+	Rate       *float64 `json:"rate"`
+	Pitch      *float64 `json:"pitch"`
+	Volume     *float64 `json:"volume"`
+	SampleRate int      `json:"sample_rate"`
+	Format     string   `json:"format"`
+}
+
+// An APIError is the body of an unsuccessful response from the JSON synthesis API.
+type APIError struct {
+	Error APIErrorDetail `json:"error"`
+}
+
+// An APIErrorDetail describes what went wrong with a request.
+// Field names the offending request field, if there is one.
+type APIErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+// SynthesizeJSON implements POST /v1/synthesize.
+// If the request has no format, the Accept header may ask for FLAC instead of WAV.
+func SynthesizeJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		ServeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "",
+			"use POST to synthesize speech")
+		return
+	}
+
+	limitBody(w, r)
+	var req SynthesizeRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		if isBodyTooLarge(err) {
+			ServeAPIError(w, http.StatusRequestEntityTooLarge, "input_too_long", "", err.Error())
+		} else {
+			ServeAPIError(w, http.StatusBadRequest, "invalid_json", "", err.Error())
+		}
+		return
+	}
+	if !checkInputLength(w, "text", req.Text) || !checkInputLength(w, "ipa", req.IPA) {
+		return
+	}
+
+	job, apiErr := req.Job()
+	if apiErr != nil {
+		ServeAPIError(w, http.StatusBadRequest, apiErr.Code, apiErr.Field, apiErr.Message)
+		return
+	}
+	if req.Format == "" {
+		job.Format = negotiateFormat(w, r, job.Format)
+	}
+
+	ServeSynthesized(w, r, job, serveAPIErrorCode)
+}
+
+// ServeAPIError writes a JSON error response.
+func ServeAPIError(w http.ResponseWriter, status int, code, field, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIError{
+		Error: APIErrorDetail{Code: code, Message: message, Field: field},
+	})
+}
+
+// An ErrorWriter sends an error response in the format of one of the server's APIs.
+// The code is a short, machine-readable name for the error.
+type ErrorWriter func(w http.ResponseWriter, status int, code, message string)
+
+// serveAPIErrorCode is the ErrorWriter for errors which do not concern a particular field.
+func serveAPIErrorCode(w http.ResponseWriter, status int, code, message string) {
+	ServeAPIError(w, status, code, "", message)
+}
+
+// A SynthesisJob is a validated request to synthesize speech.
+type SynthesisJob struct {
+	VoiceName string
+	Voice     gospeech.Voice
+	Params    gospeech.SynthesisParams
+	Format    audio.Format
+
+	// Sentences contains the IPA to synthesize, split up so that it can be streamed.
+	Sentences []string
+}
+
+// Job validates the request and fills in default values.
+func (s *SynthesizeRequest) Job() (*SynthesisJob, *APIErrorDetail) {
+	if (s.Text == "") == (s.IPA == "") {
+		return nil, &APIErrorDetail{
+			Code:    "invalid_input",
+			Message: "exactly one of text and ipa must be provided",
+		}
+	}
+
+	job, apiErr := s.settings()
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	if s.Text != "" {
+		for _, sentence := range gospeech.SplitSentences(s.Text) {
+			job.Sentences = append(job.Sentences, Dictionary.TranslateToIPA(sentence))
+		}
+	} else {
+		job.Sentences = splitPhonetic(s.IPA)
+	}
+	return job, nil
+}
+
+// settings creates a job without any sentences from the voice, prosody, and format fields of the
+// request.
+func (s *SynthesizeRequest) settings() (*SynthesisJob, *APIErrorDetail) {
+	invalid := func(field, format string, args ...interface{}) *APIErrorDetail {
+		return &APIErrorDetail{
+			Code:    "invalid_parameter",
+			Field:   field,
+			Message: fmt.Sprintf(format, args...),
+		}
+	}
+
+	job := &SynthesisJob{
+		VoiceName: s.Voice,
+		Params:    gospeech.DefaultSynthesisParams,
+		Format:    audio.WAV,
+	}
+
+	if job.VoiceName == "" {
+		job.VoiceName = "default"
+	}
+	var ok bool
+	job.Voice, ok = gospeech.Voices[job.VoiceName]
+	if !ok {
+		return nil, &APIErrorDetail{
+			Code:    "unknown_voice",
+			Field:   "voice",
+			Message: "unknown voice: " + job.VoiceName,
+		}
+	}
+
+	if s.Rate != nil {
+		if *s.Rate < minRate || *s.Rate > maxRate {
+			return nil, invalid("rate", "rate must be between %g and %g", minRate, maxRate)
+		}
+		job.Params.Rate = *s.Rate
+	}
+	if s.Pitch != nil {
+		if *s.Pitch < minPitch || *s.Pitch > maxPitch {
+			return nil, invalid("pitch", "pitch must be between %g and %g", minPitch, maxPitch)
+		}
+		job.Params.Pitch = *s.Pitch
+	}
+	if s.Volume != nil {
+		if *s.Volume < 0 || *s.Volume > maxVolume {
+			return nil, invalid("volume", "volume must be between 0 and %g", maxVolume)
+		}
+		job.Params.Volume = *s.Volume
+	}
+	if s.SampleRate != 0 {
+		if s.SampleRate < minSampleRate || s.SampleRate > gospeech.MaxSampleRate {
+			return nil, invalid("sample_rate", "sample_rate must be between %d and %d",
+				minSampleRate, gospeech.MaxSampleRate)
+		}
+		job.Params.SampleRate = s.SampleRate
+	}
+
+	if s.Format != "" {
+		var err error
+		job.Format, err = audio.ParseFormat(s.Format)
+		if err != nil {
+			return nil, invalid("format", "%s", err.Error())
+		}
+	}
+	return job, nil
+}
+
+// acceptedFormats maps MIME types from Accept headers to the formats they request.
+var acceptedFormats = map[string]audio.Format{
+	"audio/wav":          audio.WAV,
+	"audio/wave":         audio.WAV,
+	"audio/x-wav":        audio.WAV,
+	"audio/flac":         audio.FLAC,
+	"audio/x-flac":       audio.FLAC,
+	"audio/basic":        audio.MuLaw,
+	"audio/x-alaw-basic": audio.ALaw,
+}
+
+// negotiateFormat picks the format that the request's Accept header prefers, for requests which
+// do not name a format explicitly, such as audio/flac or audio/basic (8 kHz μ-law).
+// Wildcards, ties, and unsupported types fall back to the given format.
+func negotiateFormat(w http.ResponseWriter, r *http.Request, fallback audio.Format) audio.Format {
+	w.Header().Add("Vary", "Accept")
+	best := fallback
+	bestQuality := -1.0
+	for _, entry := range strings.Split(r.Header.Get("Accept"), ",") {
+		params := strings.Split(entry, ";")
+		mimeType := strings.ToLower(strings.TrimSpace(params[0]))
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		format, ok := acceptedFormats[mimeType]
+		if mimeType == "*/*" || mimeType == "audio/*" {
+			format, ok = fallback, true
+		}
+		if !ok || quality <= 0 {
+			continue
+		}
+		if quality > bestQuality || (quality == bestQuality && format == fallback) {
+			best, bestQuality = format, quality
+		}
+	}
+	return best
+}
@@ -1,7 +1,9 @@
 (function() {
 
+  var READY_STATE_DONE = 4;
+  var HTTP_OK = 200;
+
   var inputType = 'text';
-  var ipaSpecialChars = 'əɛʌæʊɔŋθðʃʒɹʔɾ';
 
   function handleInputTypeChanged() {
     var isIPA = document.getElementById('ipa-input-type').checked;
@@ -31,12 +33,40 @@
     }
   }
 
-  function configureSpecialCharacters() {
+  // fetchSpecialCharacters gets the phones of the default voice from the server and calls back
+  // with the ones that cannot be typed on a regular keyboard, grouped by type.
+  function fetchSpecialCharacters(callback) {
+    var xhr = new XMLHttpRequest();
+    xhr.onreadystatechange = function() {
+      if (xhr.readyState !== READY_STATE_DONE) {
+        return;
+      }
+      if (xhr.status !== HTTP_OK) {
+        callback([]);
+        return;
+      }
+      var phones = JSON.parse(xhr.responseText).phones.filter(function(phone) {
+        return phone.symbol.charCodeAt(0) > 127;
+      });
+      phones.sort(function(a, b) {
+        if (a.type !== b.type) {
+          return a.type < b.type ? -1 : 1;
+        }
+        return a.symbol < b.symbol ? -1 : 1;
+      });
+      callback(phones);
+    };
+    xhr.open('GET', '/voices/default/phones');
+    xhr.send(null);
+  }
+
+  function configureSpecialCharacters(phones) {
     var ipaInput = document.getElementById('ipa-input');
-    for (var i = 0, len = ipaSpecialChars.length; i < len; ++i) {
-      var char = ipaSpecialChars[i];
+    for (var i = 0, len = phones.length; i < len; ++i) {
+      var char = phones[i].symbol;
       var button = document.createElement('button');
       button.innerText = char;
+      button.title = phones[i].type.replace(/_/g, ' ');
       button.addEventListener('click', function(char) {
         var textInput = document.getElementById('text-input');
         textInput.value += char;
@@ -79,7 +109,7 @@
 
   window.addEventListener('load', function() {
     configureInputTypeControls();
-    configureSpecialCharacters();
+    fetchSpecialCharacters(configureSpecialCharacters);
     handleInputTypeChanged();
   });
 
@@ -16,7 +16,8 @@
       window.app.enableInput();
       alert('Failed to play.');
     });
-    audio.addEventListener('canplaythrough', function() {
+    // The server streams audio, so playback can start before it is fully loaded.
+    audio.addEventListener('canplay', function() {
       window.app.enableInput();
       audio.play();
     });
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheFileMagic starts every file in a cache directory.
+// It is followed by the length of the audio as a little-endian uint64, so that truncated files
+// can be detected.
+var cacheFileMagic = []byte("GSPC\x01")
+
+const cacheFileHeaderSize = 5 + 8
+
+// A SynthesisCache stores the encoded audio of recently synthesized jobs.
+//
+// Entries live in memory, and optionally in a directory on disk, which can be larger and
+// survives restarts.
+// Each tier evicts its least recently used entries when it grows beyond its size limit.
+type SynthesisCache struct {
+	lock sync.Mutex
+
+	memory     lruIndex
+	memoryData map[string][]byte
+
+	dir  string
+	disk lruIndex
+}
+
+// NewSynthesisCache creates a cache which keeps up to memoryBytes of audio in memory.
+//
+// If dir is not empty, up to diskBytes of audio are also stored in files in dir.
+// Files left in dir from previous runs are reused, except for any which are incomplete.
+func NewSynthesisCache(memoryBytes int64, dir string, diskBytes int64) (*SynthesisCache, error) {
+	c := &SynthesisCache{
+		memory:     newLRUIndex(memoryBytes),
+		memoryData: map[string][]byte{},
+		dir:        dir,
+		disk:       newLRUIndex(diskBytes),
+	}
+	if dir == "" {
+		return c, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	listing, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(listing, func(i, j int) bool {
+		return listing[i].ModTime().Before(listing[j].ModTime())
+	})
+	for _, info := range listing {
+		name := info.Name()
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if strings.HasSuffix(name, ".tmp") {
+			// Left behind by a write that never finished.
+			os.Remove(filepath.Join(dir, name))
+		} else if strings.HasSuffix(name, ".audio") {
+			key := strings.TrimSuffix(name, ".audio")
+			if checkCacheFile(c.path(key), info.Size()) {
+				c.disk.add(key, info.Size()-cacheFileHeaderSize)
+			} else {
+				os.Remove(c.path(key))
+			}
+		}
+	}
+	c.evictDisk()
+	return c, nil
+}
+
+// Get looks up the audio for a key.
+// Entries found on disk are brought back into memory.
+func (c *SynthesisCache) Get(key string) ([]byte, bool) {
+	c.lock.Lock()
+	if data, ok := c.memoryData[key]; ok {
+		c.memory.touch(key)
+		c.lock.Unlock()
+		return data, true
+	}
+	onDisk := c.dir != "" && c.disk.contains(key)
+	c.lock.Unlock()
+	if !onDisk {
+		return nil, false
+	}
+
+	data, err := readCacheFile(c.path(key))
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err != nil {
+		c.disk.remove(key)
+		os.Remove(c.path(key))
+		return nil, false
+	}
+	c.disk.touch(key)
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+	c.addMemory(key, data)
+	return data, true
+}
+
+// Put stores the audio for a key.
+//
+// Files are written under a temporary name and renamed into place, so that a crash or a full
+// disk never leaves a partial entry behind.
+// The lock is not held while writing, so lookups can continue in the meantime.
+func (c *SynthesisCache) Put(key string, data []byte) {
+	c.lock.Lock()
+	if _, ok := c.memoryData[key]; !ok {
+		c.addMemory(key, data)
+	}
+	toDisk := c.dir != "" && !c.disk.contains(key) && int64(len(data)) <= c.disk.maxSize
+	c.lock.Unlock()
+	if !toDisk {
+		return
+	}
+
+	if err := writeCacheFile(c.dir, c.path(key), data); err != nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.disk.add(key, int64(len(data)))
+	c.evictDisk()
+}
+
+func (c *SynthesisCache) addMemory(key string, data []byte) {
+	if int64(len(data)) > c.memory.maxSize {
+		return
+	}
+	c.memoryData[key] = data
+	c.memory.add(key, int64(len(data)))
+	for _, evicted := range c.memory.evict() {
+		delete(c.memoryData, evicted)
+	}
+}
+
+func (c *SynthesisCache) evictDisk() {
+	for _, evicted := range c.disk.evict() {
+		os.Remove(c.path(evicted))
+	}
+}
+
+func (c *SynthesisCache) path(key string) string {
+	return filepath.Join(c.dir, key+".audio")
+}
+
+// writeCacheFile atomically replaces a cache file with some audio.
+func writeCacheFile(dir, path string, data []byte) error {
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	var header [cacheFileHeaderSize]byte
+	copy(header[:], cacheFileMagic)
+	binary.LittleEndian.PutUint64(header[len(cacheFileMagic):], uint64(len(data)))
+	_, err = f.Write(header[:])
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// readCacheFile reads the audio from a cache file, failing if the file is truncated.
+func readCacheFile(path string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !validCacheHeader(contents, int64(len(contents))) {
+		return nil, errors.New("corrupt cache file: " + path)
+	}
+	return contents[cacheFileHeaderSize:], nil
+}
+
+// checkCacheFile checks if the header of a cache file matches the file's size.
+func checkCacheFile(path string, size int64) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, cacheFileHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return validCacheHeader(header, size)
+}
+
+func validCacheHeader(header []byte, size int64) bool {
+	if len(header) < cacheFileHeaderSize || !bytes.HasPrefix(header, cacheFileMagic) {
+		return false
+	}
+	length := binary.LittleEndian.Uint64(header[len(cacheFileMagic):])
+	return length == uint64(size-cacheFileHeaderSize)
+}
+
+// CacheKey identifies the audio that a job will produce.
+// Jobs with the same voice, parameters, format, and IPA (up to whitespace) share a key.
+func (s *SynthesisJob) CacheKey() string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%g\n%g\n%g\n%d\n%s\n", s.VoiceName, s.Params.Rate, s.Params.Pitch,
+		s.Params.Volume, s.Params.SampleRate, s.Format)
+	for _, sentence := range s.Sentences {
+		fmt.Fprintln(hash, strings.Join(strings.Fields(sentence), " "))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// An lruIndex tracks the sizes and recency of cache entries.
+type lruIndex struct {
+	maxSize  int64
+	size     int64
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+type lruEntry struct {
+	key  string
+	size int64
+}
+
+func newLRUIndex(maxSize int64) lruIndex {
+	return lruIndex{
+		maxSize:  maxSize,
+		order:    list.New(),
+		elements: map[string]*list.Element{},
+	}
+}
+
+func (l *lruIndex) contains(key string) bool {
+	_, ok := l.elements[key]
+	return ok
+}
+
+func (l *lruIndex) add(key string, size int64) {
+	l.remove(key)
+	l.elements[key] = l.order.PushFront(&lruEntry{key: key, size: size})
+	l.size += size
+}
+
+func (l *lruIndex) touch(key string) {
+	if elem, ok := l.elements[key]; ok {
+		l.order.MoveToFront(elem)
+	}
+}
+
+func (l *lruIndex) remove(key string) {
+	if elem, ok := l.elements[key]; ok {
+		l.size -= elem.Value.(*lruEntry).size
+		l.order.Remove(elem)
+		delete(l.elements, key)
+	}
+}
+
+// evict removes the least recently used entries until the index fits in its maximum size.
+// It returns the keys of the removed entries.
+func (l *lruIndex) evict() []string {
+	var res []string
+	for l.size > l.maxSize && l.order.Len() > 0 {
+		key := l.order.Back().Value.(*lruEntry).key
+		l.remove(key)
+		res = append(res, key)
+	}
+	return res
+}
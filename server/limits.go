@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+)
+
+// ErrQueueFull is returned by WorkerPool.Acquire when too many requests are already waiting.
+var ErrQueueFull = errors.New("too many synthesis requests are waiting")
+
+// A WorkerPool limits how many synthesis jobs run at once.
+//
+// Jobs beyond the limit wait in a queue of bounded length, and jobs beyond that are rejected
+// rather than piling up.
+type WorkerPool struct {
+	workers chan struct{}
+	waiting chan struct{}
+}
+
+// NewWorkerPool creates a pool which runs up to workers jobs at once, with up to queueSize more
+// waiting for a turn.
+func NewWorkerPool(workers, queueSize int) *WorkerPool {
+	return &WorkerPool{
+		workers: make(chan struct{}, workers),
+		waiting: make(chan struct{}, workers+queueSize),
+	}
+}
+
+// Acquire waits for a turn to run a job.
+//
+// If the queue is full, ErrQueueFull is returned immediately.
+// If the context is done before a turn is available, the context's error is returned.
+// Otherwise, the returned function must be called once the job finishes.
+func (w *WorkerPool) Acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case w.waiting <- struct{}{}:
+	default:
+		return nil, ErrQueueFull
+	}
+	select {
+	case w.workers <- struct{}{}:
+		return func() {
+			<-w.workers
+			<-w.waiting
+		}, nil
+	case <-ctx.Done():
+		<-w.waiting
+		return nil, ctx.Err()
+	}
+}
+
+// checkInputLength sends a 413 error and returns false if an input is longer than
+// MaxInputLength characters.
+func checkInputLength(w http.ResponseWriter, field, input string) bool {
+	if utf8.RuneCountInString(input) > MaxInputLength {
+		ServeAPIError(w, http.StatusRequestEntityTooLarge, "input_too_long", field,
+			field+" is longer than the limit of "+strconv.Itoa(MaxInputLength)+" characters")
+		return false
+	}
+	return true
+}
+
+// limitBody caps the size of a request body to what the longest allowed input could need,
+// even if every character were escaped.
+func limitBody(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, int64(MaxInputLength)*12+4096)
+}
+
+// isBodyTooLarge checks if an error came from reading past the limit set by limitBody.
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
@@ -2,61 +2,390 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"embed"
+	"flag"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/unixpickle/gospeech"
+	"github.com/unixpickle/gospeech/audio"
+	"github.com/unixpickle/wav"
 )
 
-var AssetsDir string
-var Dictionary gospeech.Dictionary
+// Assets contains the web interface, which is embedded in the binary by default.
+//
+//go:embed assets
+var Assets embed.FS
+
+var Dictionary gospeech.Lexicon
+var Cache *SynthesisCache
+
+// Workers limits how much synthesis runs at once.
+var Workers *WorkerPool
+
+// MaxInputLength is the maximum number of characters of text or phonetics in a request.
+var MaxInputLength int
+
+// RequestTimeout limits how long a request may wait for and spend on synthesis.
+var RequestTimeout time.Duration
 
 func main() {
-	if len(os.Args) != 4 {
-		fmt.Fprintln(os.Stderr, "Usage: server <dictionary.txt> <assets_dir> <port>")
+	var addr, assetsDir, dictPath, voicePaths, tlsCert, tlsKey, logLevel, cacheDir string
+	var cacheMB, diskCacheMB int64
+	var workers, queueSize int
+	flag.StringVar(&addr, "addr", ":8080", "address to listen on")
+	flag.StringVar(&assetsDir, "assets", "", "directory of web assets (defaults to the built-in assets)")
+	flag.StringVar(&dictPath, "dict", "", "dictionary file (defaults to the built-in dictionary)")
+	flag.StringVar(&voicePaths, "voices", "", "comma-separated list of voice files to load")
+	flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file (requires -tls-key)")
+	flag.StringVar(&tlsKey, "tls-key", "", "TLS private key file (requires -tls-cert)")
+	flag.StringVar(&logLevel, "log-level", "info", "minimum level of log messages (debug, info, warn, error)")
+	flag.Int64Var(&cacheMB, "cache-size", 64, "megabytes of audio to cache in memory")
+	flag.StringVar(&cacheDir, "cache-dir", "", "directory for an on-disk audio cache")
+	flag.Int64Var(&diskCacheMB, "cache-dir-size", 1024, "megabytes of audio to cache on disk")
+	flag.IntVar(&MaxInputLength, "max-input", 10000, "maximum characters of input per request")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "maximum number of concurrent syntheses")
+	flag.IntVar(&queueSize, "queue", 64, "maximum number of requests waiting for a worker")
+	flag.DurationVar(&RequestTimeout, "timeout", 30*time.Second, "time limit for each request")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: server [flags]")
+		fmt.Fprintln(os.Stderr, "       server [flags] <assets_dir> <port>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// The positional arguments are still accepted for compatibility with older scripts.
+	if flag.NArg() == 2 {
+		if port, err := strconv.Atoi(flag.Arg(1)); err != nil || port < 0 || port > 65535 {
+			fmt.Fprintln(os.Stderr, "Invalid port:", flag.Arg(1))
+			os.Exit(1)
+		}
+		assetsDir = flag.Arg(0)
+		addr = ":" + flag.Arg(1)
+	} else if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if workers < 1 {
+		fmt.Fprintln(os.Stderr, "The number of workers must be at least 1.")
 		os.Exit(1)
 	}
+	if queueSize < 0 {
+		fmt.Fprintln(os.Stderr, "The queue size must not be negative.")
+		os.Exit(1)
+	}
+	if (tlsCert == "") != (tlsKey == "") {
+		fmt.Fprintln(os.Stderr, "The -tls-cert and -tls-key flags must be used together.")
+		os.Exit(1)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid log level:", logLevel)
+		os.Exit(1)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	if err := setup(assetsDir, dictPath, voicePaths); err != nil {
+		slog.Error("setup failed", "error", err)
+		os.Exit(1)
+	}
+	Workers = NewWorkerPool(workers, queueSize)
 
 	var err error
-	Dictionary, err = gospeech.LoadDictionary(os.Args[1])
+	Cache, err = NewSynthesisCache(cacheMB<<20, cacheDir, diskCacheMB<<20)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		slog.Error("failed to create cache", "error", err)
 		os.Exit(1)
 	}
 
-	AssetsDir = os.Args[2]
+	srv := &http.Server{Addr: addr, Handler: LogRequests(http.DefaultServeMux)}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		slog.Info("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("shutdown failed", "error", err)
+		}
+	}()
 
-	if port, err := strconv.Atoi(os.Args[3]); err != nil || port < 0 || port > 65535 {
-		fmt.Fprintln(os.Stderr, "Invalid port:", os.Args[3])
+	slog.Info("listening", "addr", addr, "tls", tlsCert != "")
+	if tlsCert != "" {
+		err = srv.ListenAndServeTLS(tlsCert, tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		slog.Error("server failed", "error", err)
 		os.Exit(1)
 	}
+	<-shutdownDone
+}
+
+// setup loads the dictionary and voices and registers the handlers.
+func setup(assetsDir, dictPath, voicePaths string) error {
+	Dictionary = gospeech.DefaultDictionary()
+	if dictPath != "" {
+		var err error
+		Dictionary, err = gospeech.LoadLexicon(dictPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if voicePaths != "" {
+		for _, path := range strings.Split(voicePaths, ",") {
+			name, voice, err := gospeech.LoadVoice(path)
+			if err != nil {
+				return err
+			}
+			gospeech.Voices[name] = voice
+			slog.Debug("loaded voice", "name", name, "path", path)
+		}
+	}
+
+	var assets http.FileSystem
+	if assetsDir != "" {
+		assets = http.Dir(assetsDir)
+	} else {
+		sub, err := fs.Sub(Assets, "assets")
+		if err != nil {
+			return err
+		}
+		assets = http.FS(sub)
+	}
 
 	http.HandleFunc("/synthesize_text", SynthesizeText)
 	http.HandleFunc("/synthesize_ipa", SynthesizeIPA)
-	http.Handle("/", http.FileServer(http.Dir(AssetsDir)))
-
-	http.ListenAndServe(":"+os.Args[3], nil)
+	http.HandleFunc("/synthesize_xsampa", SynthesizeXSAMPA)
+	http.HandleFunc("/v1/synthesize", SynthesizeJSON)
+	http.HandleFunc("/v1/stream", SynthesizeStream)
+	http.HandleFunc("/v1/audio/speech", SynthesizeOpenAI)
+	http.HandleFunc("/voices", ListVoices)
+	http.HandleFunc("/voices/", ListPhones)
+	http.Handle("/", http.FileServer(assets))
+	return nil
 }
 
 func SynthesizeText(w http.ResponseWriter, r *http.Request) {
+	job, ok := formJob(w, r)
+	if !ok {
+		return
+	}
 	text := r.FormValue("text")
-	ipa := Dictionary.TranslateToIPA(text)
-	ServeSynthesized(w, r, ipa)
+	if !checkInputLength(w, "text", text) {
+		return
+	}
+	for _, sentence := range gospeech.SplitSentences(text) {
+		job.Sentences = append(job.Sentences, Dictionary.TranslateToIPA(sentence))
+	}
+	ServeSynthesized(w, r, job, serveAPIErrorCode)
 }
 
 func SynthesizeIPA(w http.ResponseWriter, r *http.Request) {
+	job, ok := formJob(w, r)
+	if !ok {
+		return
+	}
 	ipa := r.FormValue("ipa")
-	ServeSynthesized(w, r, ipa)
+	if !checkInputLength(w, "ipa", ipa) {
+		return
+	}
+	job.Sentences = splitPhonetic(ipa)
+	ServeSynthesized(w, r, job, serveAPIErrorCode)
+}
+
+func SynthesizeXSAMPA(w http.ResponseWriter, r *http.Request) {
+	job, ok := formJob(w, r)
+	if !ok {
+		return
+	}
+	xsampa := r.FormValue("xsampa")
+	if !checkInputLength(w, "xsampa", xsampa) {
+		return
+	}
+	for _, phrase := range splitPhonetic(xsampa) {
+		ipa, err := gospeech.XSAMPAToIPA(phrase)
+		if err != nil {
+			ServeAPIError(w, http.StatusBadRequest, "invalid_input", "xsampa", err.Error())
+			return
+		}
+		job.Sentences = append(job.Sentences, ipa)
+	}
+	ServeSynthesized(w, r, job, serveAPIErrorCode)
+}
+
+// ServeSynthesized sends a job's audio to the client.
+//
+// Audio from the cache is served directly.
+// Otherwise, the job waits for a turn in Workers, and is then streamed one sentence at a time so
+// that playback can start before the whole job is done, and then it is added to the cache.
+// The ETag is derived from the job itself, so it is weak: identical jobs differ in their random
+// noise, and a streamed response is not byte-for-byte the same as the cached copy of its audio.
+//
+// Errors are sent with serveError, in the format of the API that the job came from.
+// If the queue is full, the client gets a 429 error.
+// If RequestTimeout passes before any audio is sent, the client gets a 503 error; if it passes
+// later, the connection is aborted so that the client does not mistake the audio for complete.
+func ServeSynthesized(w http.ResponseWriter, r *http.Request, job *SynthesisJob,
+	serveError ErrorWriter) {
+	key := job.CacheKey()
+	etag := `W/"` + key + `"`
+
+	// Synthesis APIs are POSTed to, so conditional requests are answered here rather than with
+	// http.ServeContent, which would fail them with 412 Precondition Failed.
+	if etagMatches(r.Header.Get("If-None-Match"), key) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if data, ok := Cache.Get(key); ok {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", job.Format.ContentType())
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), RequestTimeout)
+	defer cancel()
+
+	release, err := Workers.Acquire(ctx)
+	if err == ErrQueueFull {
+		w.Header().Set("Retry-After", "1")
+		serveError(w, http.StatusTooManyRequests, "server_busy", err.Error())
+		return
+	} else if err != nil {
+		serveTimeout(w, r, serveError)
+		return
+	}
+	defer release()
+
+	// The headers are sent along with the first sentence, so that a timeout on the first
+	// sentence can still be reported, and so that error responses never carry the ETag.
+	var stream audio.StreamWriter
+	startStream := func() bool {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", job.Format.ContentType())
+		w.Header().Set("Accept-Ranges", "none")
+		stream, err = audio.NewStreamWriter(w, job.Format, job.Params.SampleRate)
+		if err != nil {
+			serveError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return false
+		}
+		return true
+	}
+
+	// Workers already bounds the number of concurrent syntheses, so each one encodes its tracks
+	// one at a time.
+	params := job.Params
+	params.EncodeWorkers = 1
+
+	var allSamples []wav.Sample
+	for _, ipa := range job.Sentences {
+		samples, err := job.Voice.RenderContext(ctx, ipa, params)
+		if err != nil {
+			if stream == nil {
+				serveTimeout(w, r, serveError)
+				return
+			}
+			panic(http.ErrAbortHandler)
+		}
+		if stream == nil && !startStream() {
+			return
+		}
+		allSamples = append(allSamples, samples...)
+		if err := stream.WriteSamples(samples); err != nil {
+			return
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+	if stream == nil && !startStream() {
+		return
+	}
+	stream.Close()
+
+	var encoded bytes.Buffer
+	if err := audio.Encode(&encoded, job.Format, allSamples, job.Params.SampleRate); err == nil {
+		Cache.Put(key, encoded.Bytes())
+	}
+}
+
+// serveTimeout reports that a request ran out of time, unless the client has already gone away.
+func serveTimeout(w http.ResponseWriter, r *http.Request, serveError ErrorWriter) {
+	if r.Context().Err() == nil {
+		serveError(w, http.StatusServiceUnavailable, "timeout",
+			"synthesis did not finish within "+RequestTimeout.String())
+	}
+}
+
+// etagMatches checks if an If-None-Match header matches an unquoted ETag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == `"`+etag+`"` {
+			return true
+		}
+	}
+	return false
+}
+
+// formJob creates a job with the default voice and parameters for one of the form-based
+// endpoints, which take an optional "format" value; without one, the format is negotiated from
+// the Accept header.
+// If the form or format is invalid, an error is sent to the client and false is returned.
+// Like every other error from these endpoints, it is in the format of the JSON API.
+func formJob(w http.ResponseWriter, r *http.Request) (*SynthesisJob, bool) {
+	limitBody(w, r)
+	if err := r.ParseForm(); err != nil {
+		if isBodyTooLarge(err) {
+			ServeAPIError(w, http.StatusRequestEntityTooLarge, "input_too_long", "", err.Error())
+		} else {
+			ServeAPIError(w, http.StatusBadRequest, "invalid_form", "", err.Error())
+		}
+		return nil, false
+	}
+	job := &SynthesisJob{
+		VoiceName: "default",
+		Voice:     gospeech.DefaultVoice,
+		Params:    gospeech.DefaultSynthesisParams,
+		Format:    audio.WAV,
+	}
+	if name := r.FormValue("format"); name != "" {
+		var err error
+		job.Format, err = audio.ParseFormat(name)
+		if err != nil {
+			ServeAPIError(w, http.StatusBadRequest, "invalid_parameter", "format", err.Error())
+			return nil, false
+		}
+	} else {
+		job.Format = negotiateFormat(w, r, job.Format)
+	}
+	return job, true
 }
 
-func ServeSynthesized(w http.ResponseWriter, r *http.Request, ipa string) {
-	wav := gospeech.DefaultVoice.Synthesize(ipa)
-	var buf bytes.Buffer
-	wav.Write(&buf)
-	reader := bytes.NewReader(buf.Bytes())
-	w.Header().Set("Content-Type", "audio/x-wav")
-	http.ServeContent(w, r, "synth.wav", time.Now(), reader)
+// splitPhonetic splits phonetic input into phrases at line breaks and IPA phrase boundaries.
+// Unlike SplitSentences, this leaves "." and "?" alone, since they are phonetic symbols in some
+// alphabets.
+func splitPhonetic(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == '\n' || r == '|' || r == '‖'
+	})
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/unixpickle/gospeech"
+	"github.com/unixpickle/gospeech/audio"
+)
+
+// openAISampleRate is the sample rate of OpenAI's speech API, which clients of the raw "pcm"
+// format rely on.
+const openAISampleRate = 24000
+
+// openAIMaxInput is the maximum number of characters that OpenAI's speech API accepts.
+const openAIMaxInput = 4096
+
+// openAIVoices are the voice names of OpenAI's speech API.
+// They are all spoken by the default voice.
+var openAIVoices = map[string]bool{
+	"alloy": true, "ash": true, "ballad": true, "coral": true, "echo": true, "fable": true,
+	"onyx": true, "nova": true, "sage": true, "shimmer": true, "verse": true,
+}
+
+// An OpenAISpeechRequest is the body of a request to OpenAI's /v1/audio/speech API.
+// The model and any instructions are accepted but ignored.
+type OpenAISpeechRequest struct {
+	Model          string   `json:"model"`
+	Input          string   `json:"input"`
+	Voice          string   `json:"voice"`
+	ResponseFormat string   `json:"response_format"`
+	Speed          *float64 `json:"speed"`
+}
+
+// An OpenAIError is the body of an unsuccessful response from OpenAI's APIs.
+type OpenAIError struct {
+	Error OpenAIErrorDetail `json:"error"`
+}
+
+// An OpenAIErrorDetail describes what went wrong with a request.
+type OpenAIErrorDetail struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+// SynthesizeOpenAI implements POST /v1/audio/speech with the same request and response shape as
+// OpenAI's text-to-speech API.
+//
+// Unlike OpenAI's API, the response format defaults to WAV (or FLAC, if the Accept header asks
+// for it), since MP3, Opus, and AAC are not supported.
+func SynthesizeOpenAI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		ServeOpenAIError(w, http.StatusMethodNotAllowed, "", "use POST to synthesize speech")
+		return
+	}
+
+	limitBody(w, r)
+	var req OpenAISpeechRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isBodyTooLarge(err) {
+			ServeOpenAIError(w, http.StatusRequestEntityTooLarge, "input", err.Error())
+		} else {
+			ServeOpenAIError(w, http.StatusBadRequest, "", "invalid JSON body: "+err.Error())
+		}
+		return
+	}
+
+	if req.Input == "" {
+		ServeOpenAIError(w, http.StatusBadRequest, "input", "input must not be empty")
+		return
+	} else if utf8.RuneCountInString(req.Input) > openAIMaxInput {
+		ServeOpenAIError(w, http.StatusBadRequest, "input",
+			"input must be at most 4096 characters")
+		return
+	} else if utf8.RuneCountInString(req.Input) > MaxInputLength {
+		ServeOpenAIError(w, http.StatusRequestEntityTooLarge, "input",
+			"input is longer than the limit of "+strconv.Itoa(MaxInputLength)+" characters")
+		return
+	}
+
+	job := &SynthesisJob{
+		VoiceName: req.Voice,
+		Params:    gospeech.DefaultSynthesisParams,
+		Format:    audio.WAV,
+	}
+	job.Params.SampleRate = openAISampleRate
+
+	if voice, ok := gospeech.Voices[req.Voice]; ok {
+		job.Voice = voice
+	} else if openAIVoices[req.Voice] {
+		job.VoiceName = "default"
+		job.Voice = gospeech.DefaultVoice
+	} else {
+		ServeOpenAIError(w, http.StatusBadRequest, "voice", "unknown voice: "+req.Voice)
+		return
+	}
+
+	if req.Speed != nil {
+		if *req.Speed < minRate || *req.Speed > maxRate {
+			ServeOpenAIError(w, http.StatusBadRequest, "speed",
+				"speed must be between 0.25 and 4.0")
+			return
+		}
+		job.Params.Rate = *req.Speed
+	}
+
+	switch req.ResponseFormat {
+	case "":
+		job.Format = negotiateFormat(w, r, audio.WAV)
+	case "wav":
+		job.Format = audio.WAV
+	case "pcm":
+		job.Format = audio.PCM
+	case "flac":
+		job.Format = audio.FLAC
+	default:
+		ServeOpenAIError(w, http.StatusBadRequest, "response_format",
+			"unsupported response_format: "+req.ResponseFormat+" (supported: wav, pcm, flac)")
+		return
+	}
+
+	for _, sentence := range gospeech.SplitSentences(req.Input) {
+		job.Sentences = append(job.Sentences, Dictionary.TranslateToIPA(sentence))
+	}
+	ServeSynthesized(w, r, job, serveOpenAIServerError)
+}
+
+// ServeOpenAIError writes an error response in the format used by OpenAI's APIs.
+// The param argument names the offending request field, or is empty.
+func ServeOpenAIError(w http.ResponseWriter, status int, param, message string) {
+	detail := OpenAIErrorDetail{
+		Message: message,
+		Type:    "invalid_request_error",
+	}
+	if param != "" {
+		detail.Param = &param
+	}
+	writeOpenAIError(w, status, detail)
+}
+
+// serveOpenAIServerError is the ErrorWriter for the OpenAI API, used for errors that are not the
+// fault of the request, such as a full queue or a timeout.
+func serveOpenAIServerError(w http.ResponseWriter, status int, code, message string) {
+	writeOpenAIError(w, status, OpenAIErrorDetail{
+		Message: message,
+		Type:    "server_error",
+		Code:    &code,
+	})
+}
+
+func writeOpenAIError(w http.ResponseWriter, status int, detail OpenAIErrorDetail) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(OpenAIError{Error: detail})
+}
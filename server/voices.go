@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/unixpickle/gospeech"
+)
+
+// A VoiceInfo describes a registered voice in the /voices listing.
+type VoiceInfo struct {
+	Name       string `json:"name"`
+	PhoneCount int    `json:"phone_count"`
+}
+
+// A PhoneInfo describes one phone that a voice can speak.
+// Symbol is the IPA symbol of the phone, except that "I" stands for "ɪ".
+type PhoneInfo struct {
+	Symbol string `json:"symbol"`
+	Type   string `json:"type"`
+}
+
+// ListVoices implements GET /voices.
+func ListVoices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		ServeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "", "use GET")
+		return
+	}
+	voices := []VoiceInfo{}
+	for name, voice := range gospeech.Voices {
+		voices = append(voices, VoiceInfo{Name: name, PhoneCount: len(voice.Phones)})
+	}
+	sort.Slice(voices, func(i, j int) bool {
+		return voices[i].Name < voices[j].Name
+	})
+	serveJSON(w, map[string]interface{}{"voices": voices})
+}
+
+// ListPhones implements GET /voices/{name}/phones.
+func ListPhones(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		ServeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "", "use GET")
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/voices/"), "/")
+	if len(parts) != 2 || parts[1] != "phones" {
+		http.NotFound(w, r)
+		return
+	}
+	name := parts[0]
+	voice, ok := gospeech.Voices[name]
+	if !ok {
+		ServeAPIError(w, http.StatusNotFound, "unknown_voice", "", "unknown voice: "+name)
+		return
+	}
+	phones := []PhoneInfo{}
+	for symbol, phone := range voice.Phones {
+		phones = append(phones, PhoneInfo{Symbol: symbol, Type: gospeech.PhoneType(phone)})
+	}
+	sort.Slice(phones, func(i, j int) bool {
+		return phones[i].Symbol < phones[j].Symbol
+	})
+	serveJSON(w, map[string]interface{}{"voice": name, "phones": phones})
+}
+
+func serveJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
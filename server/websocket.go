@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"github.com/unixpickle/gospeech"
+	"github.com/unixpickle/gospeech/audio"
+)
+
+// streamFrameSamples is the number of samples in each binary audio frame sent over a WebSocket.
+const streamFrameSamples = 4096
+
+var upgrader = websocket.Upgrader{}
+
+// A StreamMessage is a JSON message sent from the client over a speech WebSocket.
+//
+// A "config" message may be sent before any text to choose the voice and parameters; the other
+// fields are the same as in a SynthesizeRequest.
+// A "text" message appends a fragment of text (or IPA, if the configured input is "ipa").
+// A "flush" message synthesizes whatever text is buffered, even if it is not a complete phrase.
+type StreamMessage struct {
+	Type       string   `json:"type"`
+	Text       string   `json:"text"`
+	Input      string   `json:"input"`
+	Voice      string   `json:"voice"`
+	Rate       *float64 `json:"rate"`
+	Pitch      *float64 `json:"pitch"`
+	Volume     *float64 `json:"volume"`
+	SampleRate int      `json:"sample_rate"`
+}
+
+// A StreamEvent is a JSON message sent to the client over a speech WebSocket.
+//
+// A "ready" event describes the audio format once the stream is configured.
+// Every phrase produces a "phrase" event, a "word" event for every spoken word, binary frames of
+// signed 16-bit little-endian PCM, and finally a "phrase_end" event.
+// Times are in milliseconds from the start of the stream's audio.
+type StreamEvent struct {
+	Type       string   `json:"type"`
+	Phrase     int      `json:"phrase,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	IPA        string   `json:"ipa,omitempty"`
+	Start      *float64 `json:"start_ms,omitempty"`
+	End        *float64 `json:"end_ms,omitempty"`
+	SampleRate int      `json:"sample_rate,omitempty"`
+	Encoding   string   `json:"encoding,omitempty"`
+	Message    string   `json:"message,omitempty"`
+}
+
+// SynthesizeStream implements a WebSocket endpoint which speaks text as it arrives, one phrase at
+// a time.
+func SynthesizeStream(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Messages are read on a separate goroutine so that a slow client cannot stall synthesis
+	// with control frames.
+	// The context is cancelled once the client disconnects, since the request context does not
+	// track hijacked connections.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	messages := make(chan StreamMessage)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(messages)
+		defer cancel()
+		for {
+			var msg StreamMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	session := &streamSession{ctx: ctx, conn: conn}
+	for msg := range messages {
+		if err := session.handle(msg); err != nil {
+			return
+		}
+	}
+}
+
+type streamSession struct {
+	ctx  context.Context
+	conn *websocket.Conn
+
+	job      *SynthesisJob
+	ipaInput bool
+
+	buffer      string
+	phraseCount int
+	samplesSent int
+}
+
+func (s *streamSession) handle(msg StreamMessage) error {
+	switch msg.Type {
+	case "config":
+		if s.job != nil {
+			return s.sendError("the stream is already configured")
+		}
+		return s.configure(msg)
+	case "text":
+		if s.job == nil {
+			if err := s.configure(StreamMessage{}); err != nil || s.job == nil {
+				return err
+			}
+		}
+		s.buffer += msg.Text
+		if utf8.RuneCountInString(s.buffer) > MaxInputLength {
+			s.buffer = ""
+			return s.sendError("text without a phrase break is longer than the limit of " +
+				strconv.Itoa(MaxInputLength) + " characters")
+		}
+		for {
+			phrase, rest, ok := nextPhrase(s.buffer)
+			if !ok {
+				return nil
+			}
+			s.buffer = rest
+			if err := s.speak(phrase); err != nil {
+				return err
+			}
+		}
+	case "flush":
+		phrase := strings.TrimSpace(s.buffer)
+		s.buffer = ""
+		if phrase == "" || s.job == nil {
+			return nil
+		}
+		return s.speak(phrase)
+	default:
+		return s.sendError("unknown message type: " + msg.Type)
+	}
+}
+
+func (s *streamSession) configure(msg StreamMessage) error {
+	req := SynthesizeRequest{
+		Voice:      msg.Voice,
+		Rate:       msg.Rate,
+		Pitch:      msg.Pitch,
+		Volume:     msg.Volume,
+		SampleRate: msg.SampleRate,
+		Format:     string(audio.PCM),
+	}
+	job, apiErr := req.settings()
+	if apiErr != nil {
+		return s.sendError(apiErr.Message)
+	}
+	switch msg.Input {
+	case "", "text":
+	case "ipa":
+		s.ipaInput = true
+	default:
+		return s.sendError("unknown input type: " + msg.Input)
+	}
+	s.job = job
+	return s.conn.WriteJSON(StreamEvent{
+		Type:       "ready",
+		SampleRate: job.Params.SampleRate,
+		Encoding:   "pcm_s16le",
+	})
+}
+
+// speak synthesizes a phrase and sends its audio and events.
+//
+// Like other requests, each phrase waits for a turn in Workers and is subject to
+// RequestTimeout; phrases which cannot be spoken produce an error event and are skipped.
+func (s *streamSession) speak(phrase string) error {
+	var words []gospeech.TranslatedWord
+	if s.ipaInput {
+		for _, word := range strings.Fields(phrase) {
+			words = append(words, gospeech.TranslatedWord{IPA: word})
+		}
+	} else {
+		words = gospeech.TranslateWords(Dictionary, phrase)
+	}
+	ipaWords := make([]string, len(words))
+	for i, word := range words {
+		ipaWords[i] = word.IPA
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, RequestTimeout)
+	defer cancel()
+	release, err := Workers.Acquire(ctx)
+	if err != nil {
+		return s.sendError("phrase skipped: " + err.Error())
+	}
+	params := s.job.Params
+	params.EncodeWorkers = 1
+	samples, timings, err := s.job.Voice.RenderTimedContext(ctx, strings.Join(ipaWords, " "),
+		params)
+	release()
+	if err != nil {
+		return s.sendError("phrase skipped: " + err.Error())
+	}
+	offset := s.duration(s.samplesSent)
+
+	s.phraseCount++
+	if err := s.conn.WriteJSON(StreamEvent{
+		Type:   "phrase",
+		Phrase: s.phraseCount,
+		Text:   phrase,
+		Start:  milliseconds(offset),
+	}); err != nil {
+		return err
+	}
+	for _, timing := range timings {
+		if err := s.conn.WriteJSON(StreamEvent{
+			Type:   "word",
+			Phrase: s.phraseCount,
+			Text:   words[timing.Index].Text,
+			IPA:    timing.IPA,
+			Start:  milliseconds(offset + timing.Start),
+			End:    milliseconds(offset + timing.End),
+		}); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < len(samples); i += streamFrameSamples {
+		end := i + streamFrameSamples
+		if end > len(samples) {
+			end = len(samples)
+		}
+		var frame bytes.Buffer
+		audio.Encode(&frame, audio.PCM, samples[i:end], params.SampleRate)
+		if err := s.conn.WriteMessage(websocket.BinaryMessage, frame.Bytes()); err != nil {
+			return err
+		}
+	}
+	s.samplesSent += len(samples)
+	return s.conn.WriteJSON(StreamEvent{
+		Type:   "phrase_end",
+		Phrase: s.phraseCount,
+		End:    milliseconds(s.duration(s.samplesSent)),
+	})
+}
+
+func (s *streamSession) sendError(message string) error {
+	return s.conn.WriteJSON(StreamEvent{Type: "error", Message: message})
+}
+
+func (s *streamSession) duration(samples int) time.Duration {
+	return time.Duration(float64(samples) / float64(s.job.Params.SampleRate) *
+		float64(time.Second))
+}
+
+// nextPhrase removes the first complete phrase from some buffered text.
+// A phrase is complete once a punctuation mark is followed by whitespace, or at a line break.
+func nextPhrase(buffer string) (phrase, rest string, ok bool) {
+	runes := []rune(buffer)
+	for i, r := range runes {
+		complete := r == '\n'
+		if strings.ContainsRune(".!?;:,", r) && i+1 < len(runes) && unicode.IsSpace(runes[i+1]) {
+			complete = true
+		}
+		if complete {
+			phrase = strings.TrimSpace(string(runes[:i+1]))
+			rest = string(runes[i+1:])
+			if phrase == "" {
+				return nextPhrase(rest)
+			}
+			return phrase, rest, true
+		}
+	}
+	return "", buffer, false
+}
+
+func milliseconds(d time.Duration) *float64 {
+	ms := float64(d.Round(time.Microsecond)) / float64(time.Millisecond)
+	return &ms
+}
@@ -0,0 +1,173 @@
+// Command synth-bench measures how quickly the tracks of a long utterance are encoded.
+//
+// The utterance is articulated once, and then encoded several times with each number of
+// workers.
+// For each number of workers, the fastest run is reported along with its real-time factor (the
+// number of seconds of audio produced per second of encoding) and its speedup over the first
+// number of workers:
+//
+//	synth-bench -repeat 20 -workers 1,2,4,8
+//
+// The real-time factor of each kind of track is reported as well.
+// The command fails if the utterance cannot be encoded at least -target times faster than real
+// time with any of the numbers of workers.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unixpickle/gospeech"
+	"github.com/unixpickle/gospeech/tracks"
+	"github.com/unixpickle/wav"
+)
+
+const defaultText = "The quick brown fox jumps over the lazy dog. " +
+	"She sells sea shells by the sea shore, and the shells she sells are surely sea shells."
+
+func main() {
+	var text, voiceName, workerList string
+	var repeat, runs int
+	var target float64
+	params := gospeech.DefaultSynthesisParams
+	flag.StringVar(&text, "text", defaultText, "English text to synthesize")
+	flag.IntVar(&repeat, "repeat", 10, "number of times to repeat the text")
+	flag.StringVar(&voiceName, "voice", "default", "name of the voice")
+	flag.IntVar(&params.SampleRate, "sample-rate", params.SampleRate, "samples per second")
+	flag.IntVar(&runs, "runs", 3, "number of encodings to time for each number of workers")
+	defaultWorkers := "1"
+	if runtime.NumCPU() > 1 {
+		defaultWorkers += "," + strconv.Itoa(runtime.NumCPU())
+	}
+	flag.StringVar(&workerList, "workers", defaultWorkers,
+		"comma-separated numbers of workers to compare")
+	flag.Float64Var(&target, "target", 10, "minimum real-time factor")
+	flag.Parse()
+
+	workerCounts, err := parseWorkers(workerList)
+	if err != nil {
+		die(err)
+	}
+	voice, ok := gospeech.Voices[voiceName]
+	if !ok {
+		die("unknown voice: " + voiceName)
+	}
+	if repeat < 1 || runs < 1 || params.SampleRate <= 0 {
+		die("repeat, runs, and sample-rate must be positive")
+	}
+
+	ipa := gospeech.DefaultDictionary().TranslateToIPA(strings.Repeat(text+" ", repeat))
+	system, _, err := voice.Articulate(context.Background(), ipa, params)
+	if err != nil {
+		die(err)
+	}
+	audioDuration := system.Duration()
+	fmt.Printf("Encoding %s of audio at %d Hz.\n", audioDuration.Round(time.Millisecond),
+		params.SampleRate)
+	fmt.Printf("%8s %12s %10s %8s\n", "workers", "time", "realtime", "speedup")
+
+	var baseline, fastest time.Duration
+	for _, workers := range workerCounts {
+		best := timeEncoding(runs, func() {
+			system.EncodeParallel(params.SampleRate, workers)
+		})
+		if baseline == 0 {
+			baseline = best
+		}
+		if fastest == 0 || best < fastest {
+			fastest = best
+		}
+		fmt.Printf("%8d %12s %9.2fx %7.2fx\n", workers, best.Round(time.Millisecond),
+			audioDuration.Seconds()/best.Seconds(), baseline.Seconds()/best.Seconds())
+	}
+
+	fmt.Println()
+	fmt.Printf("%-12s %12s %10s\n", "track", "time", "realtime")
+	for _, bench := range trackBenchmarks() {
+		best := timeEncoding(runs, func() {
+			bench.Track.Encode(params.SampleRate)
+		})
+		fmt.Printf("%-12s %12s %9.2fx\n", bench.Name, best.Round(time.Microsecond),
+			bench.Track.Duration().Seconds()/best.Seconds())
+	}
+
+	if factor := audioDuration.Seconds() / fastest.Seconds(); factor < target {
+		die(fmt.Sprintf("real-time factor %.2fx is below the target of %.2fx", factor, target))
+	}
+}
+
+// timeEncoding runs an encoding several times and returns the duration of the fastest run.
+func timeEncoding(runs int, encode func()) time.Duration {
+	var best time.Duration
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		encode()
+		if elapsed := time.Since(start); i == 0 || elapsed < best {
+			best = elapsed
+		}
+	}
+	return best
+}
+
+type trackBenchmark struct {
+	Name  string
+	Track interface {
+		Duration() time.Duration
+		Encode(sampleRate int) []wav.Sample
+	}
+}
+
+// trackBenchmarks creates ten seconds of each kind of track, changing its parameters throughout.
+func trackBenchmarks() []trackBenchmark {
+	const duration = 10 * time.Second
+
+	tone := tracks.NewToneTrack(500, 0.3, 0)
+	tone.AdjustAll(700, 0.2, 0, duration)
+
+	noisyTone := tracks.NewToneTrack(2000, 0.3, 500)
+	noisyTone.AdjustAll(2500, 0.2, 500, duration)
+
+	whiteNoise := tracks.NewNoiseTrack(tracks.WhiteNoise, 5000, 2000, 0.3)
+	whiteNoise.AdjustAll(4000, 1000, 0.1, duration)
+
+	pinkNoise := tracks.NewNoiseTrack(tracks.PinkNoise, 2000, 1000, 0.3)
+	pinkNoise.AdjustAll(3000, 500, 0.1, duration)
+
+	sawtooth := tracks.NewSawtoothTrack(120, 3)
+	params := sawtooth.Parameters()
+	params.Volume = 0.3
+	params.Strength = 0.01
+	copy(params.Formants, []float64{500, 1500, 2500})
+	sawtooth.AdjustParameters(params, duration)
+
+	return []trackBenchmark{
+		{"tone", tone},
+		{"noisy tone", noisyTone},
+		{"white noise", whiteNoise},
+		{"pink noise", pinkNoise},
+		{"sawtooth", sawtooth},
+	}
+}
+
+func parseWorkers(list string) ([]int, error) {
+	var res []int
+	for _, field := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid number of workers: %q", field)
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+func die(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,31 @@
+package tracks
+
+import "math"
+
+// Components are faded out between these fractions of the Nyquist frequency, so that nothing a
+// track renders can alias at the requested sample rate.
+const (
+	bandLimitStart = 0.8
+	bandLimitEnd   = 0.95
+)
+
+// bandLimit returns the highest frequency a track may render at a sample rate.
+func bandLimit(sampleRate int) float64 {
+	return bandLimitEnd * float64(sampleRate) / 2
+}
+
+// bandLimitGain returns a number between 0 and 1 by which a component at the given frequency
+// should be scaled.
+// It is 1 well below the Nyquist frequency and falls smoothly to 0 at bandLimit(sampleRate).
+func bandLimitGain(freq float64, sampleRate int) float64 {
+	nyquist := float64(sampleRate) / 2
+	start := bandLimitStart * nyquist
+	end := bandLimitEnd * nyquist
+	freq = math.Abs(freq)
+	if freq <= start {
+		return 1
+	} else if freq >= end {
+		return 0
+	}
+	return 0.5 + 0.5*math.Cos(math.Pi*(freq-start)/(end-start))
+}
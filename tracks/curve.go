@@ -0,0 +1,50 @@
+package tracks
+
+import "math"
+
+// A Curve determines how a parameter moves from one value to another during a transition.
+type Curve int
+
+const (
+	// Linear moves at a constant rate.
+	Linear Curve = iota
+
+	// Cosine eases in and out, so the transition starts and ends smoothly.
+	Cosine
+
+	// Exponential moves at a constant rate in decibels, treating values 60dB below the larger
+	// endpoint as silence.
+	// This suits volumes, which may start or end at zero.
+	Exponential
+
+	// Logarithmic moves at a constant rate in octaves.
+	// This suits frequencies in Hz.
+	// It acts like Linear if either endpoint is not positive.
+	Logarithmic
+)
+
+// exponentialFloor is the fraction of the larger endpoint that Exponential treats as silence.
+const exponentialFloor = 1e-3
+
+// interpolate computes the value of a parameter which has made it fracDone of the way through a
+// transition from start to end.
+func (c Curve) interpolate(start, end, fracDone float64) float64 {
+	switch c {
+	case Cosine:
+		fracDone = 0.5 - 0.5*math.Cos(math.Pi*fracDone)
+	case Exponential:
+		if start >= 0 && end >= 0 && start != end {
+			floor := exponentialFloor * math.Max(start, end)
+			return math.Max(0, geometricInterpolate(start+floor, end+floor, fracDone)-floor)
+		}
+	case Logarithmic:
+		if start > 0 && end > 0 {
+			return geometricInterpolate(start, end, fracDone)
+		}
+	}
+	return fracDone*end + (1-fracDone)*start
+}
+
+func geometricInterpolate(start, end, fracDone float64) float64 {
+	return start * math.Pow(end/start, fracDone)
+}
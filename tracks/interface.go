@@ -1,6 +1,10 @@
 package tracks
 
 import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/unixpickle/wav"
@@ -28,6 +32,18 @@ type Track interface {
 	// AdjustVolume elongates the track while simultaneously
 	// adjusting the volume of the current sound.
 	AdjustVolume(newVolume float64, transitionTime time.Duration)
+
+	// AdjustVolumeCurve is like AdjustVolume, but the volume
+	// follows a curve during the transition.
+	AdjustVolumeCurve(newVolume float64, transitionTime time.Duration, curve Curve)
+
+	// Stretch multiplies the duration of everything in the track
+	// by a factor, making the track slower or faster.
+	Stretch(factor float64)
+
+	// Transpose multiplies every frequency in the track by a factor,
+	// raising or lowering its pitch without affecting its timing.
+	Transpose(factor float64)
 }
 
 // A TrackID is a string used to identify tracks in a TrackSet.
@@ -64,28 +80,114 @@ func (t TrackSet) Duration() (maxDur time.Duration) {
 
 // Encode generates samples by encoding every track in the set and
 // summing up the signals.
-func (t TrackSet) Encode(sampleRate int) (res []wav.Sample) {
+//
+// Tracks are encoded concurrently, using up to GOMAXPROCS goroutines.
+func (t TrackSet) Encode(sampleRate int) []wav.Sample {
+	return t.EncodeParallel(sampleRate, 0)
+}
+
+// EncodeParallel is like Encode, but it encodes up to workers tracks
+// at once, or up to GOMAXPROCS tracks if workers is less than 1.
+//
+// This is recursive with other TrackSets: the tracks of every nested
+// TrackSet share the same workers.
+// The signals are summed in order of their track IDs, so the result
+// does not depend on the number of workers.
+func (t TrackSet) EncodeParallel(sampleRate, workers int) []wav.Sample {
+	res, _ := t.EncodeParallelContext(context.Background(), sampleRate, workers)
+	return res
+}
+
+// EncodeContext is like Encode, but it checks the context before
+// encoding each track and returns the context's error if it is done.
+//
+// This is recursive with other TrackSets.
+func (t TrackSet) EncodeContext(ctx context.Context, sampleRate int) ([]wav.Sample, error) {
+	return t.EncodeParallelContext(ctx, sampleRate, 0)
+}
+
+// EncodeParallelContext combines EncodeParallel and EncodeContext.
+//
+// Callers that already run many encodings at once can pass one
+// worker, so that the number of encodings bounds their CPU use.
+func (t TrackSet) EncodeParallelContext(ctx context.Context, sampleRate,
+	workers int) ([]wav.Sample, error) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	leaves := t.leaves()
+	encodedTracks := make([][]wav.Sample, len(leaves))
+	encoded := make([]bool, len(leaves))
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(leaves); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indices {
+				if ctx.Err() != nil {
+					return
+				}
+				encodedTracks[idx] = leaves[idx].Encode(sampleRate)
+				encoded[idx] = true
+			}
+		}()
+	}
+SendLoop:
+	for i := range leaves {
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			break SendLoop
+		}
+	}
+	close(indices)
+	wg.Wait()
+	for _, ok := range encoded {
+		if !ok {
+			return nil, ctx.Err()
+		}
+	}
+
 	sampleCount := 0
-	encodedTracks := make([][]wav.Sample, 0, len(t))
-	for _, track := range t {
-		encodedTrack := track.Encode(sampleRate)
-		encodedTracks = append(encodedTracks, encodedTrack)
+	for _, encodedTrack := range encodedTracks {
 		if len(encodedTrack) > sampleCount {
 			sampleCount = len(encodedTrack)
 		}
 	}
+	return sumTracks(encodedTracks, sampleCount), nil
+}
 
-	res = make([]wav.Sample, sampleCount)
-	for i := range res {
-		for _, enc := range encodedTracks {
-			if i >= len(enc) {
-				continue
-			}
-			res[i] += enc[i]
+// leaves returns every track in the set and its nested TrackSets
+// which is not itself a TrackSet, sorted by the tracks' IDs.
+func (t TrackSet) leaves() []Track {
+	ids := make([]string, 0, len(t))
+	for id := range t {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+
+	var res []Track
+	for _, id := range ids {
+		track := t[TrackID(id)]
+		if ts, ok := track.(TrackSet); ok {
+			res = append(res, ts.leaves()...)
+		} else {
+			res = append(res, track)
 		}
 	}
+	return res
+}
 
-	return
+func sumTracks(encodedTracks [][]wav.Sample, sampleCount int) []wav.Sample {
+	res := make([]wav.Sample, sampleCount)
+	for _, enc := range encodedTracks {
+		for i, sample := range enc {
+			res[i] += sample
+		}
+	}
+	return res
 }
 
 // Continue elongates all of the set's tracks by a given duration.
@@ -112,6 +214,20 @@ func (t TrackSet) EvenOut() {
 	}
 }
 
+// Stretch stretches every track in the set.
+func (t TrackSet) Stretch(factor float64) {
+	for _, track := range t {
+		track.Stretch(factor)
+	}
+}
+
+// Transpose transposes every track in the set.
+func (t TrackSet) Transpose(factor float64) {
+	for _, track := range t {
+		track.Transpose(factor)
+	}
+}
+
 // Volume returns the sum of the volumes in all the tracks.
 func (t TrackSet) Volume() (sum float64) {
 	for _, track := range t {
@@ -123,8 +239,13 @@ func (t TrackSet) Volume() (sum float64) {
 // AdjustVolume elongates all of the tracks while simultaneously adjusting their volumes.
 // All the volumes will be set equally such that the sum of all the volumes is newVolume.
 func (t TrackSet) AdjustVolume(newVolume float64, duration time.Duration) {
+	t.AdjustVolumeCurve(newVolume, duration, Linear)
+}
+
+// AdjustVolumeCurve is like AdjustVolume, but every track's volume follows a curve.
+func (t TrackSet) AdjustVolumeCurve(newVolume float64, duration time.Duration, curve Curve) {
 	vol := newVolume / float64(len(t))
 	for _, track := range t {
-		track.AdjustVolume(vol, duration)
+		track.AdjustVolumeCurve(vol, duration, curve)
 	}
 }
@@ -0,0 +1,112 @@
+package tracks
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+const benchmarkSampleRate = 22050
+
+func TestTrackSetEncodeDeterministic(t *testing.T) {
+	// Noise tracks are left out, since they are random.
+	set := TrackSet{
+		"Formants": TrackSet{},
+		"Liquid":   testToneTrack(time.Second/2, 500, 0),
+	}
+	for i := 0; i < 12; i++ {
+		set["Formants"].(TrackSet)[TrackID(fmt.Sprint(i))] = testToneTrack(time.Second,
+			float64(200+150*i), 0)
+	}
+
+	expected, err := set.EncodeParallelContext(context.Background(), benchmarkSampleRate, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) != sampleIndex(set.Duration(), benchmarkSampleRate) {
+		t.Fatalf("unexpected sample count: %d", len(expected))
+	}
+	for _, workers := range []int{0, 2, 3, 16} {
+		for attempt := 0; attempt < 3; attempt++ {
+			actual, err := set.EncodeParallelContext(context.Background(), benchmarkSampleRate,
+				workers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(actual) != len(expected) {
+				t.Fatalf("workers %d: expected %d samples but got %d", workers, len(expected),
+					len(actual))
+			}
+			for i, x := range expected {
+				if actual[i] != x {
+					t.Fatalf("workers %d: sample %d differs", workers, i)
+				}
+			}
+		}
+	}
+}
+
+func TestTrackSetEncodeCanceled(t *testing.T) {
+	set := benchmarkTrackSet(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := set.EncodeParallelContext(ctx, benchmarkSampleRate, 2); err != context.Canceled {
+		t.Errorf("expected context.Canceled but got %v", err)
+	}
+}
+
+func BenchmarkTrackSetEncode(b *testing.B) {
+	benchmarkTrackSetEncode(b, 1)
+}
+
+func BenchmarkTrackSetEncodeParallel(b *testing.B) {
+	benchmarkTrackSetEncode(b, 0)
+}
+
+func benchmarkTrackSetEncode(b *testing.B, workers int) {
+	set := benchmarkTrackSet(10 * time.Second)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set.EncodeParallel(benchmarkSampleRate, workers)
+	}
+	reportRealTime(b, set.Duration())
+}
+
+// benchmarkTrackSet creates a set of tracks shaped like a VocalSystem, whose parameters change
+// throughout.
+func benchmarkTrackSet(d time.Duration) TrackSet {
+	set := TrackSet{
+		"Formants": TrackSet{
+			"F1": testToneTrack(d, 500, 0),
+			"F2": testToneTrack(d, 1500, 0),
+			"F3": testToneTrack(d, 2500, 0),
+		},
+		"Turbulence": TrackSet{},
+		"Humm":       testToneTrack(d, 350, 50),
+		"Liquid":     testToneTrack(d, 500, 0),
+	}
+	for i := 0; i < 10; i++ {
+		color := WhiteNoise
+		if i%2 == 1 {
+			color = PinkNoise
+		}
+		noise := NewNoiseTrack(color, float64(500+400*i), 1000, 0.1)
+		noise.AdjustAll(float64(1000+400*i), 500, 0.05, d)
+		set["Turbulence"].(TrackSet)[TrackID(fmt.Sprint(i))] = noise
+	}
+	return set
+}
+
+func testToneTrack(d time.Duration, freq, spread float64) *ToneTrack {
+	tone := NewToneTrack(freq, 0.3, spread)
+	tone.AdjustAll(freq*1.5, 0.1, spread, d/2)
+	tone.AdjustAllCurve(freq, 0.3, spread, d/2, Logarithmic, Cosine)
+	return tone
+}
+
+// reportRealTime reports how many seconds of audio are encoded per second of benchmark time.
+func reportRealTime(b *testing.B, audio time.Duration) {
+	perOp := b.Elapsed().Seconds() / float64(b.N)
+	b.ReportMetric(audio.Seconds()/perOp, "x-realtime")
+}
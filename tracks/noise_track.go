@@ -0,0 +1,295 @@
+package tracks
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"time"
+
+	"github.com/unixpickle/wav"
+)
+
+// noiseFilterInterval is the number of samples between updates of a NoiseTrack's filter
+// coefficients.
+const noiseFilterInterval = 32
+
+// A NoiseColor determines the spectrum of the noise that a NoiseTrack filters.
+type NoiseColor int
+
+const (
+	// WhiteNoise has equal power at every frequency.
+	WhiteNoise NoiseColor = iota
+
+	// PinkNoise loses 3dB of power per octave, like the noise of turbulent air.
+	PinkNoise
+)
+
+// Paul Kellet's pink noise filter: a sum of one-pole lowpass filters applied to white noise.
+var (
+	pinkPoles = [6]float64{0.99886, 0.99332, 0.96900, 0.86650, 0.55000, -0.7616}
+	pinkGains = [6]float64{0.0555179, 0.0750759, 0.1538520, 0.3104856, 0.5329522, -0.0168980}
+)
+
+const (
+	pinkDirectGain  = 0.5362
+	pinkDelayedGain = 0.115926
+)
+
+// A NoiseTrack generates noise and passes it through a bandpass filter with a time-varying center
+// frequency and bandwidth.
+//
+// The noise is scaled so that its RMS amplitude matches that of a sine wave with the track's
+// volume, regardless of the bandwidth or sample rate.
+// The center frequency never exceeds the band limit of the sample rate.
+type NoiseTrack struct {
+	color    NoiseColor
+	segments []*filterSegment
+}
+
+// NewNoiseTrack generates a zero-length NoiseTrack which starts with the given filter and volume.
+// The center and bandwidth are in Hz.
+func NewNoiseTrack(color NoiseColor, center, bandwidth, volume float64) *NoiseTrack {
+	return &NoiseTrack{
+		color: color,
+		segments: []*filterSegment{
+			&filterSegment{
+				startCenter:    center,
+				startBandwidth: bandwidth,
+				startVolume:    volume,
+				endCenter:      center,
+				endBandwidth:   bandwidth,
+				endVolume:      volume,
+			},
+		},
+	}
+}
+
+func (n *NoiseTrack) Duration() (res time.Duration) {
+	for _, seg := range n.segments {
+		res += seg.duration
+	}
+	return
+}
+
+func (n *NoiseTrack) Encode(sampleRate int) []wav.Sample {
+	res := make([]wav.Sample, sampleIndex(n.Duration(), sampleRate))
+	source := newNoiseSource(n.color)
+	secondsPerSample := 1 / float64(sampleRate)
+
+	var filter bandpassFilter
+	var scale float64
+	var segmentStartTime time.Duration
+	for _, segment := range n.segments {
+		segmentEndTime := segmentStartTime + segment.duration
+		startIndex := sampleIndex(segmentStartTime, sampleRate)
+		endIndex := sampleIndex(segmentEndTime, sampleRate)
+
+		center, bandwidth, volume := segment.infoAtFraction(0)
+		static := segment.static()
+		for i := startIndex; i < endIndex; i++ {
+			if !static {
+				elapsed := float64(i)*secondsPerSample - segmentStartTime.Seconds()
+				fracDone := elapsed / segment.duration.Seconds()
+				center, bandwidth, volume = segment.infoAtFraction(fracDone)
+			}
+			if i%noiseFilterInterval == 0 || i == startIndex {
+				filterCenter := math.Max(1, math.Min(bandLimit(sampleRate), center))
+				filterBandwidth := math.Max(1, bandwidth)
+				filter.setBand(filterCenter, filterBandwidth, sampleRate)
+				gain := source.gainAt(filterCenter, sampleRate)
+				scale = 1 / math.Sqrt(2*filter.noisePower()*gain*gain)
+			}
+			res[i] = wav.Sample(filter.apply(source.next()) * scale * volume)
+		}
+
+		segmentStartTime = segmentEndTime
+	}
+
+	return res
+}
+
+// Continue elongates the track without modifying it.
+func (n *NoiseTrack) Continue(duration time.Duration) {
+	lastSeg := n.lastSegment()
+	if lastSeg.static() {
+		lastSeg.duration += duration
+	} else {
+		n.AdjustAll(lastSeg.endCenter, lastSeg.endBandwidth, lastSeg.endVolume, duration)
+	}
+}
+
+// Volume returns the noise's current amplitude.
+func (n *NoiseTrack) Volume() float64 {
+	return n.lastSegment().endVolume
+}
+
+// AdjustVolume elongates the track while adjusting the noise's amplitude.
+func (n *NoiseTrack) AdjustVolume(volume float64, duration time.Duration) {
+	n.AdjustVolumeCurve(volume, duration, Linear)
+}
+
+// AdjustVolumeCurve is like AdjustVolume, but the amplitude follows a curve.
+func (n *NoiseTrack) AdjustVolumeCurve(volume float64, duration time.Duration, curve Curve) {
+	n.AdjustAllCurve(n.Center(), n.Bandwidth(), volume, duration, Linear, curve)
+}
+
+// Center returns the current center frequency of the filter.
+func (n *NoiseTrack) Center() float64 {
+	return n.lastSegment().endCenter
+}
+
+// Bandwidth returns the current bandwidth of the filter.
+func (n *NoiseTrack) Bandwidth() float64 {
+	return n.lastSegment().endBandwidth
+}
+
+// AdjustFilter elongates the track while adjusting the filter's center frequency and bandwidth.
+func (n *NoiseTrack) AdjustFilter(center, bandwidth float64, duration time.Duration) {
+	n.AdjustAll(center, bandwidth, n.Volume(), duration)
+}
+
+// AdjustAll elongates the track while adjusting the filter and the noise's amplitude.
+func (n *NoiseTrack) AdjustAll(center, bandwidth, volume float64, duration time.Duration) {
+	n.AdjustAllCurve(center, bandwidth, volume, duration, Linear, Linear)
+}
+
+// AdjustAllCurve is like AdjustAll, but the filter follows filterCurve and the amplitude follows
+// volumeCurve.
+func (n *NoiseTrack) AdjustAllCurve(center, bandwidth, volume float64, duration time.Duration,
+	filterCurve, volumeCurve Curve) {
+	lastSeg := n.lastSegment()
+	seg := &filterSegment{
+		duration:       duration,
+		filterCurve:    filterCurve,
+		volumeCurve:    volumeCurve,
+		startCenter:    lastSeg.endCenter,
+		startBandwidth: lastSeg.endBandwidth,
+		startVolume:    lastSeg.endVolume,
+		endCenter:      center,
+		endBandwidth:   bandwidth,
+		endVolume:      volume,
+	}
+	n.segments = append(n.segments, seg)
+}
+
+// Stretch scales the duration of every part of the track.
+func (n *NoiseTrack) Stretch(factor float64) {
+	for _, seg := range n.segments {
+		seg.duration = time.Duration(float64(seg.duration) * factor)
+	}
+}
+
+// Transpose scales the filter's center frequency and bandwidth throughout the track.
+func (n *NoiseTrack) Transpose(factor float64) {
+	for _, seg := range n.segments {
+		seg.startCenter *= factor
+		seg.endCenter *= factor
+		seg.startBandwidth *= factor
+		seg.endBandwidth *= factor
+	}
+}
+
+func (n *NoiseTrack) lastSegment() *filterSegment {
+	return n.segments[len(n.segments)-1]
+}
+
+type filterSegment struct {
+	duration       time.Duration
+	filterCurve    Curve
+	volumeCurve    Curve
+	startCenter    float64
+	startBandwidth float64
+	startVolume    float64
+	endCenter      float64
+	endBandwidth   float64
+	endVolume      float64
+}
+
+func (f *filterSegment) static() bool {
+	return f.startCenter == f.endCenter &&
+		f.startBandwidth == f.endBandwidth &&
+		f.startVolume == f.endVolume
+}
+
+func (f *filterSegment) infoAtFraction(fracDone float64) (center, bandwidth, volume float64) {
+	center = f.filterCurve.interpolate(f.startCenter, f.endCenter, fracDone)
+	bandwidth = f.filterCurve.interpolate(f.startBandwidth, f.endBandwidth, fracDone)
+	volume = f.volumeCurve.interpolate(f.startVolume, f.endVolume, fracDone)
+	return
+}
+
+// A noiseSource generates unit-variance white noise, optionally colored by the pink filter.
+type noiseSource struct {
+	rng     *rand.Rand
+	color   NoiseColor
+	poles   [6]float64
+	delayed float64
+}
+
+func newNoiseSource(color NoiseColor) *noiseSource {
+	return &noiseSource{rng: newTrackRand(), color: color}
+}
+
+func (n *noiseSource) next() float64 {
+	white := n.rng.NormFloat64()
+	if n.color != PinkNoise {
+		return white
+	}
+	res := white*pinkDirectGain + n.delayed
+	for i, pole := range pinkPoles {
+		n.poles[i] = pole*n.poles[i] + pinkGains[i]*white
+		res += n.poles[i]
+	}
+	n.delayed = white * pinkDelayedGain
+	return res
+}
+
+// gainAt returns the magnitude of the source's spectrum at a frequency, relative to that of
+// unit-variance white noise.
+func (n *noiseSource) gainAt(freq float64, sampleRate int) float64 {
+	if n.color != PinkNoise {
+		return 1
+	}
+	return n.pinkResponse(freq, sampleRate)
+}
+
+// pinkResponse computes the magnitude of the pink filter's frequency response.
+func (n *noiseSource) pinkResponse(freq float64, sampleRate int) float64 {
+	z := cmplx.Exp(complex(0, -2*math.Pi*freq/float64(sampleRate)))
+	res := complex(pinkDirectGain, 0) + complex(pinkDelayedGain, 0)*z
+	for i, pole := range pinkPoles {
+		res += complex(pinkGains[i], 0) / (1 - complex(pole, 0)*z)
+	}
+	return cmplx.Abs(res)
+}
+
+// A bandpassFilter is a biquad bandpass filter with a peak gain of 1.
+type bandpassFilter struct {
+	b0, b2, a1, a2 float64
+	x1, x2, y1, y2 float64
+}
+
+func (b *bandpassFilter) setBand(center, bandwidth float64, sampleRate int) {
+	w0 := 2 * math.Pi * center / float64(sampleRate)
+	alpha := math.Sin(w0) * bandwidth / (2 * center)
+	a0 := 1 + alpha
+	b.b0 = alpha / a0
+	b.b2 = -alpha / a0
+	b.a1 = -2 * math.Cos(w0) / a0
+	b.a2 = (1 - alpha) / a0
+}
+
+// noisePower returns the variance of the filter's output when its input is unit-variance white
+// noise.
+func (b *bandpassFilter) noisePower() float64 {
+	// The filter is (1 - A(z)) / 2 for an allpass filter A whose first impulse response sample is
+	// a2, so its power gain is (1 - a2) / 2, which is b0.
+	return b.b0
+}
+
+func (b *bandpassFilter) apply(x float64) float64 {
+	y := b.b0*x + b.b2*b.x2 - b.a1*b.y1 - b.a2*b.y2
+	b.x2, b.x1 = b.x1, x
+	b.y2, b.y1 = b.y1, y
+	return y
+}
@@ -0,0 +1,63 @@
+package tracks
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// sineTableSize is the number of entries in one cycle of sineTable.
+// With linear interpolation, lookups are within 3e-7 of math.Sin.
+const sineTableSize = 4096
+
+// sineTable holds one cycle of a sine wave, plus a repeat of the first entry so that lookups
+// can interpolate without wrapping.
+var sineTable = makeSineTable()
+
+func makeSineTable() []float64 {
+	res := make([]float64, sineTableSize+1)
+	for i := range res {
+		res[i] = math.Sin(2 * math.Pi * float64(i) / sineTableSize)
+	}
+	return res
+}
+
+// sineCycle computes sin(2*pi*phase) for a phase in [0, 1).
+// Other phases, including NaN and infinities, give 0 rather than indexing outside the table.
+func sineCycle(phase float64) float64 {
+	x := phase * sineTableSize
+	if !(x >= 0 && x < sineTableSize) {
+		return 0
+	}
+	i := int(x)
+	frac := x - float64(i)
+	return sineTable[i] + frac*(sineTable[i+1]-sineTable[i])
+}
+
+// advancePhase adds an increment to a phase and wraps the result into [0, 1).
+//
+// If the result is not finite, as after a NaN or infinite frequency, the phase starts over at 0
+// so that the oscillator recovers once its frequency is valid again.
+func advancePhase(phase, increment float64) float64 {
+	phase += increment
+	if !(phase >= 0 && phase < 1) {
+		phase -= math.Floor(phase)
+		if !(phase >= 0 && phase < 1) {
+			// Rounding can turn a tiny negative phase into exactly 1, and phases which are not
+			// finite become NaN.
+			phase = 0
+		}
+	}
+	return phase
+}
+
+// sampleIndex returns the index of the first sample at or after a time.
+func sampleIndex(t time.Duration, sampleRate int) int {
+	return int(math.Ceil(t.Seconds() * float64(sampleRate)))
+}
+
+// newTrackRand creates a random source for one encoding of a track, so that tracks which are
+// encoded concurrently do not contend for the global source.
+func newTrackRand() *rand.Rand {
+	return rand.New(rand.NewSource(rand.Int63()))
+}
@@ -0,0 +1,89 @@
+package tracks
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSineCycle(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		phase := float64(i) / 1000
+		if diff := math.Abs(sineCycle(phase) - math.Sin(2*math.Pi*phase)); diff > 1e-6 {
+			t.Errorf("phase %f: error %e", phase, diff)
+		}
+	}
+	for _, phase := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), -0.5, 1, 1e300} {
+		if x := sineCycle(phase); x != 0 {
+			t.Errorf("phase %f: expected 0 but got %f", phase, x)
+		}
+	}
+}
+
+func TestAdvancePhase(t *testing.T) {
+	tests := []struct {
+		phase, increment, expected float64
+	}{
+		{0, 0.25, 0.25},
+		{0.75, 0.5, 0.25},
+		{0.25, -0.5, 0.75},
+		{0, 3.5, 0.5},
+		{0, -1e-20, 0},
+		{0.5, math.NaN(), 0},
+		{0.5, math.Inf(1), 0},
+		{0.5, math.Inf(-1), 0},
+	}
+	for _, test := range tests {
+		if actual := advancePhase(test.phase, test.increment); actual != test.expected {
+			t.Errorf("advancePhase(%f, %f): expected %f but got %f", test.phase, test.increment,
+				test.expected, actual)
+		}
+	}
+}
+
+func TestToneTrackNonFinite(t *testing.T) {
+	for _, freq := range []float64{0, math.NaN(), math.Inf(1)} {
+		tone := NewToneTrack(440, 0.5, 0)
+		tone.AdjustFrequency(freq, 10*time.Millisecond)
+		tone.AdjustFrequency(440, 10*time.Millisecond)
+		samples := tone.Encode(8000)
+		if len(samples) != 160 {
+			t.Errorf("frequency %f: expected 160 samples but got %d", freq, len(samples))
+		}
+	}
+}
+
+func BenchmarkToneTrack(b *testing.B) {
+	tone := testToneTrack(10*time.Second, 500, 0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tone.Encode(benchmarkSampleRate)
+	}
+	reportRealTime(b, tone.Duration())
+}
+
+func BenchmarkToneTrackSpread(b *testing.B) {
+	tone := testToneTrack(10*time.Second, 2000, 500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tone.Encode(benchmarkSampleRate)
+	}
+	reportRealTime(b, tone.Duration())
+}
+
+func BenchmarkSawtoothTrack(b *testing.B) {
+	const duration = 10 * time.Second
+	sawtooth := NewSawtoothTrack(120, 3)
+	params := sawtooth.Parameters()
+	params.Volume = 0.3
+	params.Strength = 0.01
+	copy(params.Formants, []float64{500, 1500, 2500})
+	sawtooth.AdjustParameters(params, duration/2)
+	copy(params.Formants, []float64{700, 1200, 2800})
+	sawtooth.AdjustParametersCurve(params, duration/2, Logarithmic, Cosine)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sawtooth.Encode(benchmarkSampleRate)
+	}
+	reportRealTime(b, sawtooth.Duration())
+}
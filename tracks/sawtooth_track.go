@@ -9,6 +9,14 @@ import (
 
 const sawtoothHarmonicCount = 50
 
+// sawtoothUpdatePeriod is the time between exact computations of a SawtoothTrack's harmonic
+// weights.
+// In between, the weights are interpolated linearly, so that changes in the parameters are
+// smooth rather than stepped.
+// The period is a fixed duration rather than a number of samples, so that the weights follow
+// the parameters closely at low sample rates too.
+const sawtoothUpdatePeriod = 125 * time.Microsecond
+
 // A SawtoothParameters represents an instantaneous state of a SawtoothTrack.
 type SawtoothParameters struct {
 	Volume   float64
@@ -49,11 +57,17 @@ func (s *SawtoothParameters) powerForFrequency(freq float64) float64 {
 
 	// I picked this formula semi-randomly, but it has the nice property of starting at 1 and
 	// decreasing slowly after that.
-	return math.Pow(1+minDistance, -4)
+	// It is (1+minDistance)^-4, without the cost of math.Pow.
+	x := 1 + minDistance
+	x *= x
+	return 1 / (x * x)
 }
 
 // A SawtoothTrack generates a sawtooth wave and filters out certain frequencies in it, acting like
 // a bandpass filter that creates certain formants.
+//
+// Harmonics near or above the Nyquist frequency of the sample rate are left out, so the wave is
+// band-limited at any sample rate.
 type SawtoothTrack struct {
 	fundamentalFrequency float64
 	amplitudeScale       float64
@@ -64,14 +78,9 @@ type SawtoothTrack struct {
 // parameters.
 // The fundFreq argument specifies the fundamental frequency for the wave's fourier series.
 func NewSawtoothTrack(fundFreq float64, formantCount int) *SawtoothTrack {
-	var maxAmplitude float64
-	for i := 1; i <= sawtoothHarmonicCount; i++ {
-		freq := float64(i) * fundFreq
-		maxAmplitude += 1 / freq
-	}
 	return &SawtoothTrack{
 		fundamentalFrequency: fundFreq,
-		amplitudeScale:       1 / maxAmplitude,
+		amplitudeScale:       sawtoothAmplitudeScale(fundFreq),
 		parts: []*sawtoothTrackPart{
 			&sawtoothTrackPart{
 				start: NewSawtoothParameters(formantCount),
@@ -89,28 +98,52 @@ func (s *SawtoothTrack) Duration() (duration time.Duration) {
 }
 
 func (s *SawtoothTrack) Encode(sampleRate int) []wav.Sample {
-	duration := s.Duration()
+	res := make([]wav.Sample, sampleIndex(s.Duration(), sampleRate))
+	harmonicGains := s.harmonicGains(sampleRate)
+	weights := make([]float64, len(harmonicGains))
+	nextWeights := make([]float64, len(harmonicGains))
+	weightSteps := make([]float64, len(harmonicGains))
+	params := NewSawtoothParameters(len(s.lastPart().end.Formants))
+	secondsPerSample := 1 / float64(sampleRate)
+	phaseIncrement := s.fundamentalFrequency * secondsPerSample
+	updateInterval := int(math.Max(1, math.Round(sawtoothUpdatePeriod.Seconds()*
+		float64(sampleRate))))
+
+	var phase float64
 	var partStartTime time.Duration
-	var partIndex int
-
-	res := []wav.Sample{}
-	tempParameters := NewSawtoothParameters(len(s.lastPart().end.Formants))
-	for {
-		secondsElapsed := float64(len(res)) / float64(sampleRate)
-		currentTime := time.Duration(float64(time.Second) * secondsElapsed)
-		if currentTime >= duration {
-			break
+	for _, part := range s.parts {
+		partEndTime := partStartTime + part.duration
+		startIndex := sampleIndex(partStartTime, sampleRate)
+		endIndex := sampleIndex(partEndTime, sampleRate)
+		weightsAt := func(out []float64, i int) {
+			elapsed := float64(i)*secondsPerSample - partStartTime.Seconds()
+			fracDone := math.Min(1, elapsed/part.duration.Seconds())
+			part.parametersAtFraction(params, fracDone)
+			s.harmonicWeights(out, params, harmonicGains)
 		}
-
-		for currentTime >= partStartTime+s.parts[partIndex].duration {
-			partStartTime += s.parts[partIndex].duration
-			partIndex++
+		for i := startIndex; i < endIndex; i++ {
+			if (i-startIndex)%updateInterval == 0 {
+				if i == startIndex {
+					weightsAt(weights, i)
+				} else {
+					copy(weights, nextWeights)
+				}
+				next := i + updateInterval
+				if next > endIndex {
+					next = endIndex
+				}
+				weightsAt(nextWeights, next)
+				for j := range weightSteps {
+					weightSteps[j] = (nextWeights[j] - weights[j]) / float64(next-i)
+				}
+			}
+			res[i] = wav.Sample(sumHarmonics(weights, phase))
+			phase = advancePhase(phase, phaseIncrement)
+			for j, step := range weightSteps {
+				weights[j] += step
+			}
 		}
-
-		part := s.parts[partIndex]
-		part.parametersAtTime(tempParameters, currentTime-partStartTime)
-		sample := s.sample(tempParameters, secondsElapsed)
-		res = append(res, wav.Sample(sample))
+		partStartTime = partEndTime
 	}
 
 	return res
@@ -123,9 +156,14 @@ func (s *SawtoothTrack) Volume() float64 {
 
 // AdjustVolume elongates the track while adjusting its volume parameter.
 func (s *SawtoothTrack) AdjustVolume(volume float64, d time.Duration) {
+	s.AdjustVolumeCurve(volume, d, Linear)
+}
+
+// AdjustVolumeCurve is like AdjustVolume, but the volume follows a curve.
+func (s *SawtoothTrack) AdjustVolumeCurve(volume float64, d time.Duration, curve Curve) {
 	newParams := s.Parameters()
 	newParams.Volume = volume
-	s.AdjustParameters(newParams, d)
+	s.AdjustParametersCurve(newParams, d, Linear, curve)
 }
 
 // Parameters returns a copy of the current parameters.
@@ -135,40 +173,125 @@ func (s *SawtoothTrack) Parameters() *SawtoothParameters {
 
 // AdjustParameters elongates the track while adjusting its parameters.
 func (s *SawtoothTrack) AdjustParameters(newParams *SawtoothParameters, d time.Duration) {
+	s.AdjustParametersCurve(newParams, d, Linear, Linear)
+}
+
+// AdjustParametersCurve is like AdjustParameters, but the formants and strength follow
+// formantCurve and the volume follows volumeCurve.
+func (s *SawtoothTrack) AdjustParametersCurve(newParams *SawtoothParameters, d time.Duration,
+	formantCurve, volumeCurve Curve) {
 	part := &sawtoothTrackPart{
-		duration: d,
-		start:    s.lastPart().end,
-		end:      newParams.Copy(),
+		duration:     d,
+		formantCurve: formantCurve,
+		volumeCurve:  volumeCurve,
+		start:        s.lastPart().end,
+		end:          newParams.Copy(),
 	}
 	s.parts = append(s.parts, part)
 }
 
+// Stretch scales the duration of every part of the track.
+func (s *SawtoothTrack) Stretch(factor float64) {
+	for _, part := range s.parts {
+		part.duration = time.Duration(float64(part.duration) * factor)
+	}
+}
+
+// Transpose scales the fundamental frequency and the formants throughout the track.
+func (s *SawtoothTrack) Transpose(factor float64) {
+	s.fundamentalFrequency *= factor
+	s.amplitudeScale = sawtoothAmplitudeScale(s.fundamentalFrequency)
+
+	// Adjacent parts share parameters, so each set of parameters must only be scaled once.
+	scaled := map[*SawtoothParameters]bool{}
+	for _, part := range s.parts {
+		for _, params := range []*SawtoothParameters{part.start, part.end} {
+			if scaled[params] {
+				continue
+			}
+			scaled[params] = true
+			for i := range params.Formants {
+				params.Formants[i] *= factor
+			}
+		}
+	}
+}
+
 func (s *SawtoothTrack) lastPart() *sawtoothTrackPart {
 	return s.parts[len(s.parts)-1]
 }
 
-func (s *SawtoothTrack) sample(params *SawtoothParameters, time float64) float64 {
-	var res float64
+// harmonicGains returns the band-limiting gain of each harmonic that can be rendered at a sample
+// rate, starting with the fundamental.
+// Harmonics past the end of the list are left out.
+func (s *SawtoothTrack) harmonicGains(sampleRate int) []float64 {
+	var res []float64
 	for i := 1; i <= sawtoothHarmonicCount; i++ {
-		freq := float64(i) * s.fundamentalFrequency
-		sinValue := (1 / freq) * math.Sin(math.Pi*2*freq*time)
-		power := params.Volume * params.powerForFrequency(freq)
-		res += power * sinValue
+		gain := bandLimitGain(float64(i)*s.fundamentalFrequency, sampleRate)
+		if gain == 0 {
+			break
+		}
+		res = append(res, gain)
+	}
+	return res
+}
+
+// harmonicWeights computes the amplitude of each harmonic for a set of parameters.
+func (s *SawtoothTrack) harmonicWeights(out []float64, params *SawtoothParameters,
+	harmonicGains []float64) {
+	for i, gain := range harmonicGains {
+		freq := float64(i+1) * s.fundamentalFrequency
+		power := gain * params.Volume * params.powerForFrequency(freq)
+		out[i] = power * s.amplitudeScale / freq
+	}
+}
+
+// sumHarmonics computes the wave at a phase of the fundamental, given the amplitude of each
+// harmonic.
+//
+// The amplitude scale does not account for the harmonics that were left out, so the wave has the
+// same loudness at every sample rate.
+func sumHarmonics(weights []float64, phase float64) float64 {
+	if len(weights) == 0 {
+		return 0
+	}
+	// Each harmonic follows from the previous two by the identity
+	// sin((n+1)x) = 2cos(x)sin(nx) - sin((n-1)x).
+	sin, cos := math.Sincos(2 * math.Pi * phase)
+	var lastSin float64
+	curSin := sin
+	res := weights[0] * curSin
+	for _, weight := range weights[1:] {
+		lastSin, curSin = curSin, 2*cos*curSin-lastSin
+		res += weight * curSin
+	}
+	return res
+}
+
+// sawtoothAmplitudeScale computes a factor which keeps the sum of the harmonics of a sawtooth
+// wave between -1 and 1.
+func sawtoothAmplitudeScale(fundFreq float64) float64 {
+	var maxAmplitude float64
+	for i := 1; i <= sawtoothHarmonicCount; i++ {
+		freq := float64(i) * fundFreq
+		maxAmplitude += 1 / freq
 	}
-	return res * s.amplitudeScale
+	return 1 / maxAmplitude
 }
 
 type sawtoothTrackPart struct {
-	duration time.Duration
-	start    *SawtoothParameters
-	end      *SawtoothParameters
+	duration     time.Duration
+	formantCurve Curve
+	volumeCurve  Curve
+	start        *SawtoothParameters
+	end          *SawtoothParameters
 }
 
-func (s *sawtoothTrackPart) parametersAtTime(out *SawtoothParameters, t time.Duration) {
-	fracDone := float64(t) / float64(s.duration)
-	out.Volume = fracDone*s.end.Volume + (1-fracDone)*s.start.Volume
-	out.Strength = fracDone*s.end.Strength + (1-fracDone)*s.start.Strength
+func (s *sawtoothTrackPart) parametersAtFraction(out *SawtoothParameters, fracDone float64) {
+	out.Volume = s.volumeCurve.interpolate(s.start.Volume, s.end.Volume, fracDone)
+	out.Strength = s.formantCurve.interpolate(s.start.Strength, s.end.Strength, fracDone)
 	for i := range out.Formants {
-		out.Formants[i] = fracDone*s.end.Formants[i] + (1-fracDone)*s.start.Formants[i]
+		out.Formants[i] = s.formantCurve.interpolate(s.start.Formants[i], s.end.Formants[i],
+			fracDone)
 	}
 }
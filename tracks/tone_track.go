@@ -2,7 +2,6 @@ package tracks
 
 import (
 	"math"
-	"math/rand"
 	"time"
 
 	"github.com/unixpickle/wav"
@@ -10,6 +9,10 @@ import (
 
 // A ToneTrack manages a pure tone with optional
 // overlaid noise.
+//
+// The tone fades out as it approaches the Nyquist frequency
+// of the sample rate, and the noise never pushes it past
+// that point, so the track does not alias.
 type ToneTrack struct {
 	currentTime time.Duration
 	segments    []*noiseSegment
@@ -42,37 +45,36 @@ func (s *ToneTrack) Duration() (res time.Duration) {
 }
 
 func (s *ToneTrack) Encode(sampleRate int) []wav.Sample {
-	duration := s.Duration()
-	var segmentStartTime time.Duration
-	var segmentIndex int
-	var sampleIndex int
-
-	res := []wav.Sample{}
-	var sineArgument float64
-	for {
-		secondsElapsed := float64(sampleIndex) / float64(sampleRate)
-		currentTime := time.Duration(float64(time.Second) * secondsElapsed)
-		if currentTime >= duration {
-			break
-		}
-
-		for currentTime >= segmentStartTime+s.segments[segmentIndex].duration {
-			segmentStartTime += s.segments[segmentIndex].duration
-			segmentIndex++
-		}
-
-		segment := s.segments[segmentIndex]
-		freq, volume, spread := segment.infoAtTime(currentTime - segmentStartTime)
-		sample := math.Sin(sineArgument) * volume
-		res = append(res, wav.Sample(sample))
+	res := make([]wav.Sample, sampleIndex(s.Duration(), sampleRate))
+	rng := newTrackRand()
+	maxFreq := bandLimit(sampleRate)
+	secondsPerSample := 1 / float64(sampleRate)
 
-		freq += rand.NormFloat64() * spread
-		sineArgument += math.Pi * 2 * freq / float64(sampleRate)
-		for sineArgument > math.Pi*2 {
-			sineArgument -= math.Pi * 2
+	var phase float64
+	var segmentStartTime time.Duration
+	for _, segment := range s.segments {
+		segmentEndTime := segmentStartTime + segment.duration
+		startIndex := sampleIndex(segmentStartTime, sampleRate)
+		endIndex := sampleIndex(segmentEndTime, sampleRate)
+
+		freq, volume, spread := segment.infoAtFraction(0)
+		static := segment.static()
+		for i := startIndex; i < endIndex; i++ {
+			if !static {
+				elapsed := float64(i)*secondsPerSample - segmentStartTime.Seconds()
+				fracDone := elapsed / segment.duration.Seconds()
+				freq, volume, spread = segment.infoAtFraction(fracDone)
+			}
+			res[i] = wav.Sample(sineCycle(phase) * volume * bandLimitGain(freq, sampleRate))
+
+			nextFreq := freq
+			if spread != 0 {
+				nextFreq = math.Max(0, math.Min(maxFreq, freq+rng.NormFloat64()*spread))
+			}
+			phase = advancePhase(phase, nextFreq*secondsPerSample)
 		}
 
-		sampleIndex++
+		segmentStartTime = segmentEndTime
 	}
 
 	return res
@@ -102,9 +104,14 @@ func (s *ToneTrack) Volume() float64 {
 	return s.lastSegment().endVolume
 }
 
-// AdjustVolume elongates the track while adjusting the tone's frequency.
+// AdjustVolume elongates the track while adjusting the tone's volume.
 func (s *ToneTrack) AdjustVolume(newVolume float64, duration time.Duration) {
-	s.AdjustAll(s.Frequency(), newVolume, s.Spread(), duration)
+	s.AdjustVolumeCurve(newVolume, duration, Linear)
+}
+
+// AdjustVolumeCurve is like AdjustVolume, but the volume follows a curve.
+func (s *ToneTrack) AdjustVolumeCurve(newVolume float64, duration time.Duration, curve Curve) {
+	s.AdjustAllCurve(s.Frequency(), newVolume, s.Spread(), duration, Linear, curve)
 }
 
 // Frequency returns the tone's current frequency.
@@ -129,9 +136,18 @@ func (s *ToneTrack) AdjustSpread(spread float64, duration time.Duration) {
 
 // AdjustAll elongates the track by while adjusting the tone's characteristics.
 func (s *ToneTrack) AdjustAll(freq, volume, spread float64, duration time.Duration) {
+	s.AdjustAllCurve(freq, volume, spread, duration, Linear, Linear)
+}
+
+// AdjustAllCurve is like AdjustAll, but the frequency and spread follow freqCurve and the volume
+// follows volumeCurve.
+func (s *ToneTrack) AdjustAllCurve(freq, volume, spread float64, duration time.Duration,
+	freqCurve, volumeCurve Curve) {
 	lastSeg := s.lastSegment()
 	seg := &noiseSegment{
 		duration:       duration,
+		freqCurve:      freqCurve,
+		volumeCurve:    volumeCurve,
 		startSpread:    lastSeg.endSpread,
 		startFrequency: lastSeg.endFrequency,
 		startVolume:    lastSeg.endVolume,
@@ -142,12 +158,31 @@ func (s *ToneTrack) AdjustAll(freq, volume, spread float64, duration time.Durati
 	s.segments = append(s.segments, seg)
 }
 
+// Stretch scales the duration of every part of the track.
+func (s *ToneTrack) Stretch(factor float64) {
+	for _, seg := range s.segments {
+		seg.duration = time.Duration(float64(seg.duration) * factor)
+	}
+}
+
+// Transpose scales the tone's frequency and random spread throughout the track.
+func (s *ToneTrack) Transpose(factor float64) {
+	for _, seg := range s.segments {
+		seg.startFrequency *= factor
+		seg.endFrequency *= factor
+		seg.startSpread *= factor
+		seg.endSpread *= factor
+	}
+}
+
 func (s *ToneTrack) lastSegment() *noiseSegment {
 	return s.segments[len(s.segments)-1]
 }
 
 type noiseSegment struct {
 	duration       time.Duration
+	freqCurve      Curve
+	volumeCurve    Curve
 	startSpread    float64
 	startFrequency float64
 	startVolume    float64
@@ -162,10 +197,9 @@ func (s *noiseSegment) static() bool {
 		s.startSpread == s.endSpread
 }
 
-func (s *noiseSegment) infoAtTime(t time.Duration) (freq, vol, spread float64) {
-	fracDone := float64(t) / float64(s.duration)
-	freq = fracDone*s.endFrequency + (1-fracDone)*s.startFrequency
-	vol = fracDone*s.endVolume + (1-fracDone)*s.startVolume
-	spread = fracDone*s.endSpread + (1-fracDone)*s.startSpread
+func (s *noiseSegment) infoAtFraction(fracDone float64) (freq, vol, spread float64) {
+	freq = s.freqCurve.interpolate(s.startFrequency, s.endFrequency, fracDone)
+	vol = s.volumeCurve.interpolate(s.startVolume, s.endVolume, fracDone)
+	spread = s.freqCurve.interpolate(s.startSpread, s.endSpread, fracDone)
 	return
 }
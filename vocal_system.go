@@ -33,25 +33,25 @@ func NewVocalSystem() VocalSystem {
 			"F3": tracks.NewToneTrack(2000, 0, 0),
 		},
 		"Turbulence": tracks.TrackSet{
-			"S":  tracks.NewToneTrack(5000, 0, 1000),
-			"SH": tracks.NewToneTrack(3500, 0, 2000),
+			"S":  tracks.NewNoiseTrack(tracks.WhiteNoise, 5000, 2000, 0),
+			"SH": tracks.NewNoiseTrack(tracks.WhiteNoise, 3500, 3000, 0),
 			"TH": tracks.TrackSet{
-				"1": tracks.NewToneTrack(500, 0, 300),
-				"2": tracks.NewToneTrack(4000, 0, 700),
+				"1": tracks.NewNoiseTrack(tracks.WhiteNoise, 500, 600, 0),
+				"2": tracks.NewNoiseTrack(tracks.WhiteNoise, 4000, 1400, 0),
 			},
-			"P": tracks.NewToneTrack(400, 0, 400),
+			"P": tracks.NewNoiseTrack(tracks.PinkNoise, 400, 800, 0),
 			"F": tracks.TrackSet{
-				"1": tracks.NewToneTrack(2000, 0, 200),
+				"1": tracks.NewNoiseTrack(tracks.WhiteNoise, 2000, 400, 0),
 			},
 			"K": tracks.TrackSet{
-				"F1": tracks.NewToneTrack(600, 0, 200),
-				"F2": tracks.NewToneTrack(500, 0, 500),
-				"F3": tracks.NewToneTrack(800, 0, 500),
+				"F1": tracks.NewNoiseTrack(tracks.PinkNoise, 600, 400, 0),
+				"F2": tracks.NewNoiseTrack(tracks.PinkNoise, 500, 1000, 0),
+				"F3": tracks.NewNoiseTrack(tracks.PinkNoise, 800, 1000, 0),
 			},
 			"H": tracks.TrackSet{
-				"F1": tracks.NewToneTrack(1000, 0, 500),
-				"F2": tracks.NewToneTrack(2250, 0, 500),
-				"F3": tracks.NewToneTrack(2890, 0, 500),
+				"F1": tracks.NewNoiseTrack(tracks.PinkNoise, 1000, 1000, 0),
+				"F2": tracks.NewNoiseTrack(tracks.PinkNoise, 2250, 1000, 0),
+				"F3": tracks.NewNoiseTrack(tracks.PinkNoise, 2890, 1000, 0),
 			},
 		},
 		"ConsonantVoice": tracks.TrackSet{
@@ -83,14 +83,24 @@ func (v VocalSystem) Formants() FormantState {
 }
 
 // AdjustFormants adjusts the formant state over a period of time.
+// The frequencies move logarithmically and the volumes ease in and out, so that transitions
+// between phones have no kinks.
 func (v VocalSystem) AdjustFormants(state FormantState, d time.Duration) {
+	v.AdjustFormantsCurve(state, d, tracks.Logarithmic, tracks.Cosine)
+}
+
+// AdjustFormantsCurve is like AdjustFormants, but the frequencies follow freqCurve and the
+// volumes follow volumeCurve.
+func (v VocalSystem) AdjustFormantsCurve(state FormantState, d time.Duration, freqCurve,
+	volumeCurve tracks.Curve) {
 	freqs := map[string]float64{"F1": state.Frequencies[0], "F2": state.Frequencies[1],
 		"F3": state.Frequencies[2]}
 	volumes := map[string]float64{"F1": state.Volumes[0], "F2": state.Volumes[1],
 		"F3": state.Volumes[2]}
 	for name, track := range v.FormantsTrack() {
 		n := string(name)
-		track.(*tracks.ToneTrack).AdjustAll(freqs[n], volumes[n], 0, d)
+		track.(*tracks.ToneTrack).AdjustAllCurve(freqs[n], volumes[n], 0, d, freqCurve,
+			volumeCurve)
 	}
 }
 
@@ -1,8 +1,12 @@
 package gospeech
 
 import (
+	"context"
+	"math"
+	"strings"
 	"time"
 
+	"github.com/unixpickle/gospeech/tracks"
 	"github.com/unixpickle/wav"
 )
 
@@ -10,7 +14,109 @@ type Voice struct {
 	Phones map[string]Phone
 }
 
+// MaxSampleRate is the highest sample rate that programs should accept from their users.
+// Higher rates add nothing audible, while the time and memory used by synthesis grow with the
+// sample rate.
+const MaxSampleRate = 96000
+
+// SynthesisParams controls the prosody and sample rate of synthesized speech.
+type SynthesisParams struct {
+	// Rate scales the speed of speech, so 2 is twice as fast as normal.
+	Rate float64
+
+	// Pitch scales every frequency in the speech, so 2 is an octave higher than normal.
+	//
+	// The voices are built from formants rather than from a glottal source and a filter, so
+	// the formants move along with the pitch.
+	// This changes the timbre as well: a higher pitch sounds like a smaller speaker rather than
+	// the same speaker talking higher.
+	Pitch float64
+
+	// Volume scales the amplitude of the speech.
+	Volume float64
+
+	// SampleRate is the number of samples per second to produce.
+	SampleRate int
+
+	// EncodeWorkers is the maximum number of tracks to encode at once, or 0 for GOMAXPROCS.
+	// Callers which run many syntheses at once can set this to 1, so that the number of
+	// syntheses bounds their CPU use.
+	EncodeWorkers int
+}
+
+// DefaultSynthesisParams are the parameters used by Voice.Synthesize.
+var DefaultSynthesisParams = SynthesisParams{
+	Rate:       1,
+	Pitch:      1,
+	Volume:     1,
+	SampleRate: 44100,
+}
+
+// Synthesize generates an 8-bit sound from a string of IPA.
 func (v Voice) Synthesize(ipaString string) wav.Sound {
+	s := wav.NewPCM8Sound(1, DefaultSynthesisParams.SampleRate)
+	s.SetSamples(v.Render(ipaString, DefaultSynthesisParams))
+	return s
+}
+
+// A WordTiming records when a word is spoken in rendered audio.
+type WordTiming struct {
+	// Index is the position of the word among the space-separated words of the IPA string.
+	Index int
+	IPA   string
+
+	Start time.Duration
+	End   time.Duration
+}
+
+// Render generates mono samples from a string of IPA.
+// Samples are clipped to the range [-1, 1].
+func (v Voice) Render(ipaString string, params SynthesisParams) []wav.Sample {
+	samples, _ := v.RenderTimed(ipaString, params)
+	return samples
+}
+
+// RenderTimed is like Render, but it also reports when each word is spoken.
+// Words without any phones known to the voice are not included in the timings.
+func (v Voice) RenderTimed(ipaString string, params SynthesisParams) ([]wav.Sample,
+	[]WordTiming) {
+	samples, timings, _ := v.RenderTimedContext(context.Background(), ipaString, params)
+	return samples, timings
+}
+
+// RenderContext is like Render, but it stops early and returns the context's error if the
+// context is done before synthesis finishes.
+func (v Voice) RenderContext(ctx context.Context, ipaString string,
+	params SynthesisParams) ([]wav.Sample, error) {
+	samples, _, err := v.RenderTimedContext(ctx, ipaString, params)
+	return samples, err
+}
+
+// RenderTimedContext is like RenderTimed, but it stops early and returns the context's error if
+// the context is done before synthesis finishes.
+func (v Voice) RenderTimedContext(ctx context.Context, ipaString string,
+	params SynthesisParams) ([]wav.Sample, []WordTiming, error) {
+	vocalSystem, timings, err := v.Articulate(ctx, ipaString, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	samples, err := vocalSystem.EncodeParallelContext(ctx, params.SampleRate,
+		params.EncodeWorkers)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, sample := range samples {
+		samples[i] = wav.Sample(math.Max(-1, math.Min(1, float64(sample)*params.Volume)))
+	}
+	return samples, timings, nil
+}
+
+// Articulate builds the tracks for a string of IPA without encoding them.
+// The rate and pitch of the parameters are applied, but not the volume or sample rate.
+//
+// It returns the context's error if the context is done before the tracks are built.
+func (v Voice) Articulate(ctx context.Context, ipaString string,
+	params SynthesisParams) (VocalSystem, []WordTiming, error) {
 	vocalSystem := NewVocalSystem()
 
 	words := [][]Phone{}
@@ -31,7 +137,13 @@ func (v Voice) Synthesize(ipaString string) wav.Sound {
 		words = append(words, word)
 	}
 
-	for _, word := range words {
+	var timings []WordTiming
+	ipaWords := strings.Split(ipaString, " ")
+	for wordIndex, word := range words {
+		if err := ctx.Err(); err != nil {
+			return VocalSystem{}, nil, err
+		}
+		start := vocalSystem.Duration()
 		for i, phone := range word {
 			var lastPhone, nextPhone Phone
 			if i > 0 {
@@ -42,13 +154,49 @@ func (v Voice) Synthesize(ipaString string) wav.Sound {
 			}
 			phone.EncodeBeginning(vocalSystem, lastPhone, nextPhone)
 		}
-		vocalSystem.AdjustVolume(0, time.Millisecond*50)
+		if len(word) > 0 {
+			timings = append(timings, WordTiming{
+				Index: wordIndex,
+				IPA:   ipaWords[wordIndex],
+				Start: time.Duration(float64(start) / params.Rate),
+				End:   time.Duration(float64(vocalSystem.Duration()) / params.Rate),
+			})
+		}
+		vocalSystem.AdjustVolumeCurve(0, time.Millisecond*50, tracks.Cosine)
 		vocalSystem.Continue(time.Millisecond * 300)
 	}
 
-	s := wav.NewPCM8Sound(1, 44100)
-	s.SetSamples(vocalSystem.Encode(44100))
-	return s
+	if params.Rate != 1 {
+		vocalSystem.Stretch(1 / params.Rate)
+	}
+	if params.Pitch != 1 {
+		vocalSystem.Transpose(params.Pitch)
+	}
+	return vocalSystem, timings, nil
+}
+
+// SynthesizeXSAMPA is like Synthesize, but it takes an X-SAMPA transcription instead of IPA.
+func (v Voice) SynthesizeXSAMPA(xsampa string) (wav.Sound, error) {
+	ipa, err := XSAMPAToIPA(xsampa)
+	if err != nil {
+		return nil, err
+	}
+	return v.Synthesize(ipa), nil
+}
+
+// SynthesizeKirshenbaum is like Synthesize, but it takes a Kirshenbaum transcription instead of
+// IPA.
+func (v Voice) SynthesizeKirshenbaum(kirshenbaum string) (wav.Sound, error) {
+	ipa, err := KirshenbaumToIPA(kirshenbaum)
+	if err != nil {
+		return nil, err
+	}
+	return v.Synthesize(ipa), nil
+}
+
+// Voices maps names to the voices which are built in to this package.
+var Voices = map[string]Voice{
+	"default": DefaultVoice,
 }
 
 var DefaultVoice = Voice{
@@ -0,0 +1,174 @@
+package gospeech
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A voiceFile is the JSON representation of a voice.
+//
+// A voice file may start from one of the built-in voices and only list the phones that differ,
+// for example:
+//
+//	{
+//	  "name": "deep",
+//	  "base": "default",
+//	  "phones": {
+//	    "a": {"type": "vowel", "formants": [[650, 0.3], [1000, 0.3], [2400, 0.3]], "duration_ms": 250},
+//	    "s": {"type": "fricative", "sound": "SH"}
+//	  }
+//	}
+//
+// Each phone symbol is a single character of IPA.
+// A phone which is null is removed from the base voice.
+type voiceFile struct {
+	Name   string                     `json:"name"`
+	Base   string                     `json:"base"`
+	Phones map[string]*phoneFileEntry `json:"phones"`
+}
+
+// A phoneFileEntry describes one phone in a voice file.
+// Which fields are used depends on the type of the phone.
+type phoneFileEntry struct {
+	Type string `json:"type"`
+
+	// Formants lists (frequency, volume) pairs for vowels, nasals, and retroflex liquids.
+	Formants [][2]float64 `json:"formants"`
+
+	// DurationMS is the length of a vowel.
+	DurationMS float64 `json:"duration_ms"`
+
+	// Voiced is used by plosives and fricatives.
+	Voiced bool `json:"voiced"`
+
+	// Sound selects the turbulence of a fricative (S, SH, TH, F, or H) or the kind of nasal
+	// (m, n, or ŋ).
+	Sound string `json:"sound"`
+
+	// ContinueToNext is used by alveolar plosives.
+	ContinueToNext bool `json:"continue_to_next"`
+}
+
+// LoadVoice reads a JSON voice file.
+//
+// The returned name comes from the file's "name" field, or from the file name if that field is
+// empty.
+// The voice is not added to Voices.
+func LoadVoice(path string) (name string, voice Voice, err error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", Voice{}, err
+	}
+	name, voice, err = parseVoice(contents)
+	if err != nil {
+		return "", Voice{}, fmt.Errorf("load voice %s: %s", path, err)
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return name, voice, nil
+}
+
+func parseVoice(contents []byte) (string, Voice, error) {
+	var file voiceFile
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return "", Voice{}, err
+	}
+
+	voice := Voice{Phones: map[string]Phone{}}
+	if file.Base != "" {
+		base, ok := Voices[file.Base]
+		if !ok {
+			return "", Voice{}, errors.New("unknown base voice: " + file.Base)
+		}
+		for symbol, phone := range base.Phones {
+			voice.Phones[symbol] = phone
+		}
+	}
+
+	for symbol, entry := range file.Phones {
+		// Voice.Articulate looks phones up one rune at a time, so longer symbols could never be
+		// used.
+		if utf8.RuneCountInString(symbol) != 1 {
+			return "", Voice{}, fmt.Errorf("phone %q: symbol must be exactly one character",
+				symbol)
+		}
+		if entry == nil {
+			delete(voice.Phones, symbol)
+			continue
+		}
+		phone, err := entry.phone()
+		if err != nil {
+			return "", Voice{}, fmt.Errorf("phone %s: %s", symbol, err)
+		}
+		voice.Phones[symbol] = phone
+	}
+	return file.Name, voice, nil
+}
+
+func (p *phoneFileEntry) phone() (Phone, error) {
+	switch p.Type {
+	case "vowel":
+		formants, err := p.formants()
+		if err != nil {
+			return nil, err
+		}
+		if p.DurationMS <= 0 {
+			return nil, errors.New("vowel needs a positive duration_ms")
+		}
+		return Vowel{
+			Formants: formants,
+			Duration: time.Duration(p.DurationMS * float64(time.Millisecond)),
+		}, nil
+	case "bilabial_plosive":
+		return BilabialPlosive{Voiced: p.Voiced}, nil
+	case "alveolar_plosive":
+		return AlveolarPlosive{Voiced: p.Voiced, ContinueToNext: p.ContinueToNext}, nil
+	case "velar_plosive":
+		return VelarPlosive{Voiced: p.Voiced}, nil
+	case "nasal":
+		formants, err := p.formants()
+		if err != nil {
+			return nil, err
+		}
+		switch p.Sound {
+		case "m", "n", "ŋ":
+		default:
+			return nil, errors.New("unknown nasal sound: " + p.Sound)
+		}
+		return Nasal{Type: p.Sound, Formants: formants}, nil
+	case "fricative":
+		switch p.Sound {
+		case "S", "SH", "TH", "F", "H":
+		default:
+			return nil, errors.New("unknown fricative sound: " + p.Sound)
+		}
+		return Fricative{Type: p.Sound, Voiced: p.Voiced}, nil
+	case "retroflex_liquid":
+		formants, err := p.formants()
+		if err != nil {
+			return nil, err
+		}
+		return RetroflexLiquid{Formants: formants}, nil
+	case "lateral_liquid":
+		return LateralLiquid{}, nil
+	case "glottal_stop":
+		return GlottalStop{}, nil
+	default:
+		return nil, errors.New("unknown phone type: " + p.Type)
+	}
+}
+
+func (p *phoneFileEntry) formants() (FormantState, error) {
+	if len(p.Formants) != 3 {
+		return FormantState{}, errors.New("expected three formants")
+	}
+	return NewFormantState(p.Formants[0][0], p.Formants[0][1], p.Formants[1][0],
+		p.Formants[1][1], p.Formants[2][0], p.Formants[2][1]), nil
+}
@@ -0,0 +1,262 @@
+// Command wyoming-server serves gospeech over the Wyoming protocol, which Home Assistant uses to
+// talk to local text-to-speech engines.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/unixpickle/gospeech"
+	"github.com/unixpickle/gospeech/audio"
+)
+
+const (
+	programName    = "gospeech"
+	programVersion = "1.0.0"
+	attributionURL = "https://github.com/unixpickle/gospeech"
+
+	// chunkSamples is the number of samples in each audio-chunk event.
+	chunkSamples = 2048
+)
+
+var Dictionary gospeech.Lexicon
+var SampleRate int
+
+// MaxInputLength is the maximum number of characters of text in a synthesize event.
+var MaxInputLength int
+
+// RequestTimeout limits how long a synthesize event may spend on synthesis.
+var RequestTimeout time.Duration
+
+func main() {
+	var uri, dictPath string
+	flag.StringVar(&uri, "uri", "tcp://0.0.0.0:10200", "address to listen on")
+	flag.StringVar(&dictPath, "dict", "", "dictionary file (defaults to the built-in dictionary)")
+	flag.IntVar(&SampleRate, "sample-rate", 22050, "sample rate of the synthesized audio")
+	flag.IntVar(&MaxInputLength, "max-input", 10000, "maximum characters of text per event")
+	flag.DurationVar(&RequestTimeout, "timeout", 30*time.Second, "time limit for each event")
+	flag.Parse()
+	if SampleRate <= 0 {
+		fmt.Fprintln(os.Stderr, "The sample rate must be positive.")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if MaxInputLength <= 0 || RequestTimeout <= 0 {
+		fmt.Fprintln(os.Stderr, "The maximum input length and timeout must be positive.")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	Dictionary = gospeech.DefaultDictionary()
+	if dictPath != "" {
+		var err error
+		Dictionary, err = gospeech.LoadLexicon(dictPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	listenURL, err := url.Parse(uri)
+	if err != nil || (listenURL.Scheme != "tcp" && listenURL.Scheme != "unix") {
+		fmt.Fprintln(os.Stderr, "Invalid URI (expected tcp://host:port or unix://path):", uri)
+		os.Exit(1)
+	}
+	address := listenURL.Host
+	if listenURL.Scheme == "unix" {
+		address = listenURL.Path
+	}
+	listener, err := net.Listen(listenURL.Scheme, address)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	log.Println("Listening on", uri)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		go HandleConnection(conn)
+	}
+}
+
+// HandleConnection answers events from a client until it disconnects.
+func HandleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	// Events are read on a separate goroutine, and the context is cancelled once the client
+	// disconnects, so that synthesis does not continue for nobody.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan *Event)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(events)
+		defer cancel()
+		reader := bufio.NewReader(conn)
+		for {
+			event, err := ReadEvent(reader)
+			if err != nil {
+				select {
+				case <-done:
+				default:
+					if err != io.EOF {
+						log.Println("Error reading event:", err)
+					}
+				}
+				return
+			}
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for event := range events {
+		var err error
+		switch event.Type {
+		case "describe":
+			err = WriteEvent(conn, Info())
+		case "synthesize":
+			err = Synthesize(ctx, conn, event)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println("Error handling event:", err)
+			}
+			return
+		}
+	}
+}
+
+// Info creates an info event advertising the available voices.
+func Info() *Event {
+	attribution := map[string]interface{}{"name": programName, "url": attributionURL}
+	var names []string
+	for name := range gospeech.Voices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var voices []interface{}
+	for _, name := range names {
+		voices = append(voices, map[string]interface{}{
+			"name":        name,
+			"description": "gospeech " + name + " formant voice",
+			"attribution": attribution,
+			"installed":   true,
+			"version":     programVersion,
+			"languages":   []string{"en"},
+		})
+	}
+	return &Event{
+		Type: "info",
+		Data: map[string]interface{}{
+			"asr":    []interface{}{},
+			"handle": []interface{}{},
+			"intent": []interface{}{},
+			"wake":   []interface{}{},
+			"tts": []interface{}{
+				map[string]interface{}{
+					"name":        programName,
+					"description": "Formant speech synthesis",
+					"attribution": attribution,
+					"installed":   true,
+					"version":     programVersion,
+					"voices":      voices,
+				},
+			},
+		},
+	}
+}
+
+// Synthesize answers a synthesize event with audio-start, audio-chunk, and audio-stop events.
+// Audio is sent one sentence at a time.
+//
+// Text longer than MaxInputLength is answered with an error event instead.
+// If the context is done or RequestTimeout passes, synthesis stops and the context's error is
+// returned, since the audio that was sent is incomplete.
+func Synthesize(ctx context.Context, w io.Writer, event *Event) error {
+	text, _ := event.Data["text"].(string)
+	if utf8.RuneCountInString(text) > MaxInputLength {
+		return WriteEvent(w, &Event{
+			Type: "error",
+			Data: map[string]interface{}{
+				"text": "text is longer than the limit of " + strconv.Itoa(MaxInputLength) +
+					" characters",
+				"code": "input_too_long",
+			},
+		})
+	}
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	voice := gospeech.DefaultVoice
+	if voiceInfo, ok := event.Data["voice"].(map[string]interface{}); ok {
+		if name, ok := voiceInfo["name"].(string); ok {
+			if v, ok := gospeech.Voices[name]; ok {
+				voice = v
+			}
+		}
+	}
+
+	params := gospeech.DefaultSynthesisParams
+	params.SampleRate = SampleRate
+	format := map[string]interface{}{"rate": SampleRate, "width": 2, "channels": 1}
+	withTimestamp := func(samples int) map[string]interface{} {
+		res := map[string]interface{}{"timestamp": samples * 1000 / SampleRate}
+		for key, value := range format {
+			res[key] = value
+		}
+		return res
+	}
+
+	if err := WriteEvent(w, &Event{Type: "audio-start", Data: withTimestamp(0)}); err != nil {
+		return err
+	}
+	var samplesSent int
+	for _, sentence := range gospeech.SplitSentences(text) {
+		samples, err := voice.RenderContext(ctx, Dictionary.TranslateToIPA(sentence), params)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(samples); i += chunkSamples {
+			end := i + chunkSamples
+			if end > len(samples) {
+				end = len(samples)
+			}
+			var payload bytes.Buffer
+			audio.Encode(&payload, audio.PCM, samples[i:end], SampleRate)
+			err := WriteEvent(w, &Event{
+				Type:    "audio-chunk",
+				Data:    withTimestamp(samplesSent),
+				Payload: payload.Bytes(),
+			})
+			if err != nil {
+				return err
+			}
+			samplesSent += end - i
+		}
+	}
+	return WriteEvent(w, &Event{
+		Type: "audio-stop",
+		Data: map[string]interface{}{"timestamp": samplesSent * 1000 / SampleRate},
+	})
+}
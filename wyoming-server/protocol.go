@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// protocolVersion is the version of the Wyoming protocol that this server speaks.
+const protocolVersion = "1.5.2"
+
+// These limit the sizes of the header, data, and payload that a peer may send with an event.
+// The header may hold data inline, so it has the same limit as the data.
+const (
+	maxHeaderLength  = 1 << 20
+	maxDataLength    = 1 << 20
+	maxPayloadLength = 16 << 20
+)
+
+// An Event is a single message of the Wyoming protocol.
+//
+// On the wire, an event is a line of JSON header, followed by data_length bytes of JSON data and
+// payload_length bytes of binary payload.
+type Event struct {
+	Type    string
+	Data    map[string]interface{}
+	Payload []byte
+}
+
+type eventHeader struct {
+	Type          string                 `json:"type"`
+	Version       string                 `json:"version,omitempty"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+	DataLength    int                    `json:"data_length,omitempty"`
+	PayloadLength int                    `json:"payload_length,omitempty"`
+}
+
+// ReadEvent reads the next event from a connection.
+// Data may be inline in the header, as older clients send it, or after the header.
+func ReadEvent(r *bufio.Reader) (*Event, error) {
+	line, err := readLine(r, maxHeaderLength)
+	if err != nil {
+		return nil, err
+	}
+	var header eventHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, err
+	}
+	if header.Type == "" {
+		return nil, errors.New("event has no type")
+	}
+	if header.DataLength < 0 || header.DataLength > maxDataLength {
+		return nil, fmt.Errorf("invalid data length: %d", header.DataLength)
+	}
+	if header.PayloadLength < 0 || header.PayloadLength > maxPayloadLength {
+		return nil, fmt.Errorf("invalid payload length: %d", header.PayloadLength)
+	}
+	event := &Event{Type: header.Type, Data: header.Data}
+	if event.Data == nil {
+		event.Data = map[string]interface{}{}
+	}
+	if header.DataLength > 0 {
+		rawData := make([]byte, header.DataLength)
+		if _, err := io.ReadFull(r, rawData); err != nil {
+			return nil, err
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(rawData, &data); err != nil {
+			return nil, err
+		}
+		for key, value := range data {
+			event.Data[key] = value
+		}
+	}
+	if header.PayloadLength > 0 {
+		event.Payload = make([]byte, header.PayloadLength)
+		if _, err := io.ReadFull(r, event.Payload); err != nil {
+			return nil, err
+		}
+	}
+	return event, nil
+}
+
+// readLine reads up to and including the next newline, failing if the line is longer than
+// maxLength bytes.
+func readLine(r *bufio.Reader, maxLength int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLength {
+			return nil, errors.New("event header is too long")
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
+
+// WriteEvent writes an event to a connection.
+func WriteEvent(w io.Writer, event *Event) error {
+	header := eventHeader{
+		Type:          event.Type,
+		Version:       protocolVersion,
+		PayloadLength: len(event.Payload),
+	}
+	var data []byte
+	if len(event.Data) > 0 {
+		var err error
+		data, err = json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		header.DataLength = len(data)
+	}
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	message := append(append(append(headerData, '\n'), data...), event.Payload...)
+	_, err = w.Write(message)
+	return err
+}